@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
@@ -12,8 +13,8 @@ import (
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/wait"
 	kubeclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -28,22 +29,133 @@ const (
 	clusterReachableMsg    = "cluster is reachable"
 )
 
+// StartHealthChecks starts the periodic health checks of all ToolchainClusters using the default cluster cache
+//
+// Deprecated: the health checks started by this function run in every replica regardless of the leader election.
+// Use AddHealthChecks instead.
 func StartHealthChecks(ctx context.Context, mgr manager.Manager, namespace string, period time.Duration) {
-	logger.Info("starting health checks", "period", period)
-	go wait.Until(func() {
-		updateClusterStatuses(ctx, namespace, mgr.GetClient())
-	}, period, ctx.Done())
+	StartHealthChecksWithCache(ctx, mgr, cluster.DefaultClusterCache(), namespace, period)
+}
+
+// DefaultMaxConcurrentHealthChecks is the default maximum number of clusters that are checked in parallel
+const DefaultMaxConcurrentHealthChecks = 10
+
+// HealthCheckOption is an option of the health checks
+type HealthCheckOption func(*healthCheckConfig)
+
+type healthCheckConfig struct {
+	probes              []HealthProbe
+	maxConcurrentChecks int
+	clusterCheckTimeout time.Duration
+	failureThreshold    int
+	successThreshold    int
+	statusHeartbeat     time.Duration
+	statusStaleAfter    time.Duration
+	// history keeps the results of the previous health checks, so it has to be shared by all the subsequent checks
+	history *healthHistory
+}
+
+func newHealthCheckConfig(options ...HealthCheckOption) *healthCheckConfig {
+	config := &healthCheckConfig{
+		probes:              DefaultHealthProbes(),
+		maxConcurrentChecks: DefaultMaxConcurrentHealthChecks,
+		failureThreshold:    1,
+		successThreshold:    1,
+		history:             newHealthHistory(),
+	}
+	for _, apply := range options {
+		apply(config)
+	}
+	return config
+}
+
+// WithHealthProbes registers the probes that are used for checking the health of the clusters instead of the default ones.
+// The cluster is ready only if it passes all the probes.
+func WithHealthProbes(probes ...HealthProbe) HealthCheckOption {
+	return func(config *healthCheckConfig) {
+		config.probes = probes
+	}
+}
+
+// WithMaxConcurrentHealthChecks sets the maximum number of clusters that are checked in parallel (DefaultMaxConcurrentHealthChecks by default)
+func WithMaxConcurrentHealthChecks(maxConcurrentChecks int) HealthCheckOption {
+	return func(config *healthCheckConfig) {
+		if maxConcurrentChecks > 0 {
+			config.maxConcurrentChecks = maxConcurrentChecks
+		}
+	}
+}
+
+// WithClusterCheckTimeout sets the deadline of the probes of a single cluster. When the deadline is exceeded, then the probes
+// fail and the cluster is marked as offline, so a slow cluster doesn't delay the checks of the other ones.
+// By default, the deadline is equal to the period of the health checks.
+func WithClusterCheckTimeout(timeout time.Duration) HealthCheckOption {
+	return func(config *healthCheckConfig) {
+		config.clusterCheckTimeout = timeout
+	}
+}
+
+// WithReadinessThresholds sets the number of consecutive failed health checks after which a ready cluster is marked
+// as not ready (or offline), and the number of consecutive successful health checks after which a cluster that is not ready
+// is marked as ready again. By default, both of them are 1, ie. the status reflects the last health check only.
+func WithReadinessThresholds(failureThreshold, successThreshold int) HealthCheckOption {
+	return func(config *healthCheckConfig) {
+		if failureThreshold > 0 {
+			config.failureThreshold = failureThreshold
+		}
+		if successThreshold > 0 {
+			config.successThreshold = successThreshold
+		}
+	}
+}
+
+// WithStatusHeartbeat sets the interval within which the status of a cluster is not written when only the probe time
+// (or the message) of its conditions would change. The status is then written at least once per the interval, so the probe time
+// still shows that the cluster is being checked. The staleAfter is the age of the probe time after which the cluster connection
+// is reported as stale, ie. the HealthCheckPeriod plus the HealthCheckTimeout of the ToolchainClusterConfig (see the status package).
+// The interval is capped by the runner, so the probe time doesn't get older than staleAfter between two writes.
+// By default, the status is written after every health check.
+func WithStatusHeartbeat(interval, staleAfter time.Duration) HealthCheckOption {
+	return func(config *healthCheckConfig) {
+		config.statusHeartbeat = interval
+		config.statusStaleAfter = staleAfter
+	}
+}
+
+// StartHealthChecksWithCache starts the periodic health checks of all ToolchainClusters.
+// The clients of the remote clusters are retrieved from the given cluster cache.
+//
+// Deprecated: the health checks started by this function run in every replica regardless of the leader election.
+// Use AddHealthChecks instead.
+func StartHealthChecksWithCache(ctx context.Context, mgr manager.Manager, cache *cluster.ClusterCache, namespace string, period time.Duration, options ...HealthCheckOption) {
+	runner := NewHealthCheckRunner(mgr.GetClient(), cache, namespace, period, options...)
+	go func() {
+		_ = runner.Start(ctx)
+	}()
 }
 
 type HealthChecker struct {
 	localClusterClient     client.Client
 	remoteClusterClient    client.Client
-	remoteClusterClientset *kubeclientset.Clientset
+	remoteClusterClientset kubeclientset.Interface
+	cluster                *cluster.CachedToolchainCluster
+	probes                 []HealthProbe
+	timeout                time.Duration
+	history                *healthHistory
+	failureThreshold       int
+	successThreshold       int
+	statusHeartbeat        time.Duration
 	logger                 logr.Logger
 }
 
-// updateClusterStatuses checks cluster health and updates status of all ToolchainClusters
-func updateClusterStatuses(ctx context.Context, namespace string, cl client.Client) {
+// updateClusterStatuses checks cluster health and updates status of all ToolchainClusters.
+// The clusters are checked in parallel, but at most the configured number of them at the same time.
+// The function returns when all the clusters are checked.
+func updateClusterStatuses(ctx context.Context, cache *cluster.ClusterCache, namespace string, cl client.Client, options ...HealthCheckOption) {
+	updateClusterStatusesWithConfig(ctx, cache, namespace, cl, newHealthCheckConfig(options...))
+}
+
+func updateClusterStatusesWithConfig(ctx context.Context, cache *cluster.ClusterCache, namespace string, cl client.Client, config *healthCheckConfig) {
 	clusters := &toolchainv1alpha1.ToolchainClusterList{}
 	err := cl.List(ctx, clusters, client.InNamespace(namespace))
 	if err != nil {
@@ -53,96 +165,234 @@ func updateClusterStatuses(ctx context.Context, namespace string, cl client.Clie
 	if len(clusters.Items) == 0 {
 		logger.Info("no ToolchainCluster found")
 	}
+	names := make(map[string]bool, len(clusters.Items))
+	for _, obj := range clusters.Items {
+		names[obj.Name] = true
+	}
+	config.history.retain(names)
+	deleteReadinessMetricsExcept(names)
 
+	workers := make(chan struct{}, config.maxConcurrentChecks)
+	var wg sync.WaitGroup
 	for _, obj := range clusters.Items {
 		clusterObj := obj.DeepCopy()
-		clusterLogger := logger.WithValues("cluster-name", clusterObj.Name)
-
-		cachedCluster, ok := cluster.GetCachedToolchainCluster(clusterObj.Name)
-		if !ok {
-			clusterLogger.Error(fmt.Errorf("cluster %s not found in cache", clusterObj.Name), "failed to retrieve stored data for cluster")
-			clusterObj.Status.Conditions = []toolchainv1alpha1.ToolchainClusterCondition{clusterOfflineCondition()}
-			if err := cl.Status().Update(ctx, clusterObj); err != nil {
-				clusterLogger.Error(err, "failed to update the status of ToolchainCluster")
-			}
-			continue
+		workers <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			updateClusterStatus(ctx, cache, cl, config, clusterObj)
+		}()
+	}
+	wg.Wait()
+}
+
+func updateClusterStatus(ctx context.Context, cache *cluster.ClusterCache, cl client.Client, config *healthCheckConfig, clusterObj *toolchainv1alpha1.ToolchainCluster) {
+	clusterLogger := logger.WithValues("cluster-name", clusterObj.Name)
+
+	cachedCluster, ok := cache.GetCachedToolchainCluster(clusterObj.Name)
+	if !ok {
+		clusterLogger.Error(fmt.Errorf("cluster %s not found in cache", clusterObj.Name), "failed to retrieve stored data for cluster")
+		conditions := []toolchainv1alpha1.ToolchainClusterCondition{clusterOfflineCondition()}
+		setReadinessMetrics(clusterObj.Name, conditions)
+		if err := updateStatusConditions(ctx, cl, clusterObj, conditions, config.statusHeartbeat); err != nil {
+			clusterLogger.Error(err, "failed to update the status of ToolchainCluster")
 		}
+		return
+	}
 
-		clientSet, err := kubeclientset.NewForConfig(cachedCluster.RestConfig)
-		if err != nil {
+	// reuse the clientset from the cache, so it's not created again for every check
+	clientSet := cachedCluster.Clientset
+	if clientSet == nil {
+		var err error
+		if clientSet, err = kubeclientset.NewForConfig(cachedCluster.RestConfig); err != nil {
 			clusterLogger.Error(err, "cannot create ClientSet for a ToolchainCluster")
-			continue
+			return
 		}
+	}
 
-		healthChecker := &HealthChecker{
-			localClusterClient:     cl,
-			remoteClusterClient:    cachedCluster.Client,
-			remoteClusterClientset: clientSet,
-			logger:                 clusterLogger,
-		}
-		// clusterLogger.Info("getting the current state of ToolchainCluster")
-		if err := healthChecker.updateIndividualClusterStatus(ctx, clusterObj); err != nil {
-			clusterLogger.Error(err, "unable to update cluster status of ToolchainCluster")
-		}
+	healthChecker := &HealthChecker{
+		localClusterClient:     cl,
+		remoteClusterClient:    cachedCluster.Client,
+		remoteClusterClientset: clientSet,
+		cluster:                cachedCluster,
+		probes:                 config.probes,
+		timeout:                config.clusterCheckTimeout,
+		history:                config.history,
+		failureThreshold:       config.failureThreshold,
+		successThreshold:       config.successThreshold,
+		statusHeartbeat:        config.statusHeartbeat,
+		logger:                 clusterLogger,
+	}
+	// clusterLogger.Info("getting the current state of ToolchainCluster")
+	if err := healthChecker.updateIndividualClusterStatus(ctx, clusterObj); err != nil {
+		clusterLogger.Error(err, "unable to update cluster status of ToolchainCluster")
 	}
 }
 
 func (hc *HealthChecker) updateIndividualClusterStatus(ctx context.Context, toolchainCluster *toolchainv1alpha1.ToolchainCluster) error {
+	probeCtx := ctx
+	if hc.timeout > 0 {
+		var cancel context.CancelFunc
+		probeCtx, cancel = context.WithTimeout(ctx, hc.timeout)
+		defer cancel()
+	}
+	currentClusterStatus := hc.getClusterHealthStatus(probeCtx)
+	results := hc.history.record(toolchainCluster.Name, cluster.IsReady(currentClusterStatus))
+	currentClusterStatus.Conditions = dampedConditions(toolchainCluster.Status.Conditions, currentClusterStatus.Conditions, results, hc.failureThreshold, hc.successThreshold)
+	if degraded, isDegraded := degradedCondition(results); isDegraded {
+		currentClusterStatus.Conditions = append(currentClusterStatus.Conditions, degraded)
+	}
+
+	setReadinessMetrics(toolchainCluster.Name, currentClusterStatus.Conditions)
+	if err := updateStatusConditions(ctx, hc.localClusterClient, toolchainCluster, currentClusterStatus.Conditions, hc.statusHeartbeat); err != nil {
+		return errors.Wrapf(err, "Failed to update the status of cluster %s", toolchainCluster.Name)
+	}
+	return nil
+}
 
-	currentClusterStatus := hc.getClusterHealthStatus(ctx)
+// updateStatusConditions merges the given conditions managed by the health checker into the status of the ToolchainCluster
+// and patches the status - the other conditions are kept as they are. The patch contains the resource version, so in case
+// of a conflict the latest version of the ToolchainCluster is retrieved and the conditions are merged into it again.
+// The status is not patched at all if only the probe time would change and the last probe time is within the heartbeat interval.
+func updateStatusConditions(ctx context.Context, cl client.Client, toolchainCluster *toolchainv1alpha1.ToolchainCluster, conditions []toolchainv1alpha1.ToolchainClusterCondition, heartbeat time.Duration) error {
+	refresh := false
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if refresh {
+			if err := cl.Get(ctx, client.ObjectKeyFromObject(toolchainCluster), toolchainCluster); err != nil {
+				return err
+			}
+		}
+		refresh = true
+		if !requiresStatusUpdate(toolchainCluster.Status.Conditions, conditions, heartbeat) {
+			return nil
+		}
+		original := toolchainCluster.DeepCopy()
+		toolchainCluster.Status.Conditions = mergeConditions(conditions, toolchainCluster.Status.Conditions)
+		return cl.Status().Patch(ctx, toolchainCluster, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{}))
+	})
+}
 
-	for index, currentCond := range currentClusterStatus.Conditions {
-		for _, previousCond := range toolchainCluster.Status.Conditions {
+// mergeConditions returns the given conditions managed by the health checker (with the transition time kept from the previous
+// conditions of the same type and status) together with the previous conditions that are not managed by the health checker
+func mergeConditions(conditions, previous []toolchainv1alpha1.ToolchainClusterCondition) []toolchainv1alpha1.ToolchainClusterCondition {
+	merged := make([]toolchainv1alpha1.ToolchainClusterCondition, len(conditions))
+	copy(merged, conditions)
+	for index, currentCond := range merged {
+		for _, previousCond := range previous {
 			if currentCond.Type == previousCond.Type && currentCond.Status == previousCond.Status {
-				currentClusterStatus.Conditions[index].LastTransitionTime = previousCond.LastTransitionTime
+				merged[index].LastTransitionTime = previousCond.LastTransitionTime
 			}
 		}
 	}
+	return withOtherConditions(merged, previous)
+}
 
-	toolchainCluster.Status = *currentClusterStatus
-	if err := hc.localClusterClient.Status().Update(ctx, toolchainCluster); err != nil {
-		return errors.Wrapf(err, "Failed to update the status of cluster %s", toolchainCluster.Name)
+// requiresStatusUpdate returns false if the conditions managed by the health checker differ from the previous ones only in the probe time
+// or in the message (eg. the Degraded condition contains the number of the recent failures), and the previous probe time is within
+// the given heartbeat interval
+func requiresStatusUpdate(previous, conditions []toolchainv1alpha1.ToolchainClusterCondition, heartbeat time.Duration) bool {
+	if heartbeat <= 0 {
+		return true
 	}
-	return nil
+	managed := 0
+	for _, previousCond := range previous {
+		if isManagedCondition(previousCond.Type) {
+			managed++
+		}
+	}
+	if managed != len(conditions) {
+		return true
+	}
+Conditions:
+	for _, currentCond := range conditions {
+		for _, previousCond := range previous {
+			if currentCond.Type != previousCond.Type {
+				continue
+			}
+			if currentCond.Status != previousCond.Status || currentCond.Reason != previousCond.Reason ||
+				time.Since(previousCond.LastProbeTime.Time) >= heartbeat {
+				return true
+			}
+			continue Conditions
+		}
+		return true
+	}
+	return false
 }
 
-// getClusterHealthStatus gets the kubernetes cluster health status by requesting "/healthz"
+// getClusterHealthStatus gets the kubernetes cluster health status by running all the registered probes.
+// The cluster is offline if any of the probes cannot reach it, and it is ready only if it passes all the probes.
+// The messages of the probes are joined in the message of the Ready condition.
 func (hc *HealthChecker) getClusterHealthStatus(ctx context.Context) *toolchainv1alpha1.ToolchainClusterStatus {
 	clusterStatus := toolchainv1alpha1.ToolchainClusterStatus{}
-	body, err := hc.remoteClusterClientset.DiscoveryClient.RESTClient().Get().AbsPath("/healthz").Do(ctx).Raw()
-	if err != nil {
-		hc.logger.Error(err, "Failed to do cluster health check for a ToolchainCluster")
-		clusterStatus.Conditions = append(clusterStatus.Conditions, clusterOfflineCondition())
-	} else {
-		if !strings.EqualFold(string(body), "ok") {
-			clusterStatus.Conditions = append(clusterStatus.Conditions, clusterNotReadyCondition(), clusterNotOfflineCondition())
+	var passed, failed []string
+	for _, probe := range hc.probes {
+		start := time.Now()
+		result := probe.Probe(ctx, hc.cluster, hc.remoteClusterClientset)
+		observeProbe(hc.cluster.Name, probe.Name(), start, result)
+		if result.Unreachable {
+			hc.logger.Error(result.Err, "Failed to do cluster health check for a ToolchainCluster", "probe", probe.Name(), "message", result.Message)
+			clusterStatus.Conditions = append(clusterStatus.Conditions, clusterOfflineCondition())
+			return &clusterStatus
+		}
+		if result.Message == "" {
+			continue
+		}
+		if result.Healthy {
+			passed = append(passed, result.Message)
 		} else {
-			clusterStatus.Conditions = append(clusterStatus.Conditions, clusterReadyCondition())
+			hc.logger.Error(result.Err, "cluster health check failed", "probe", probe.Name(), "message", result.Message)
+			failed = append(failed, result.Message)
 		}
 	}
+	if len(failed) > 0 {
+		clusterStatus.Conditions = append(clusterStatus.Conditions, clusterNotReadyCondition(strings.Join(failed, "; ")), clusterNotOfflineCondition())
+	} else {
+		clusterStatus.Conditions = append(clusterStatus.Conditions, clusterReadyCondition(strings.Join(passed, "; ")))
+	}
 
 	return &clusterStatus
 }
 
-func clusterReadyCondition() toolchainv1alpha1.ToolchainClusterCondition {
+// withOtherConditions appends the previous conditions that are not managed by the health checker (eg. ConfigurationValid)
+// to the given conditions
+func withOtherConditions(conditions, previous []toolchainv1alpha1.ToolchainClusterCondition) []toolchainv1alpha1.ToolchainClusterCondition {
+	for _, condition := range previous {
+		if !isManagedCondition(condition.Type) {
+			conditions = append(conditions, condition)
+		}
+	}
+	return conditions
+}
+
+// isManagedCondition returns true if the condition of the given type is set by the health checker
+func isManagedCondition(conditionType toolchainv1alpha1.ToolchainClusterConditionType) bool {
+	return conditionType == toolchainv1alpha1.ToolchainClusterReady || conditionType == toolchainv1alpha1.ToolchainClusterOffline ||
+		conditionType == ToolchainClusterDegraded
+}
+
+func clusterReadyCondition(message string) toolchainv1alpha1.ToolchainClusterCondition {
 	currentTime := metav1.Now()
 	return toolchainv1alpha1.ToolchainClusterCondition{
 		Type:               toolchainv1alpha1.ToolchainClusterReady,
 		Status:             corev1.ConditionTrue,
 		Reason:             toolchainv1alpha1.ToolchainClusterClusterReadyReason,
-		Message:            healthzOk,
+		Message:            message,
 		LastProbeTime:      currentTime,
 		LastTransitionTime: &currentTime,
 	}
 }
 
-func clusterNotReadyCondition() toolchainv1alpha1.ToolchainClusterCondition {
+func clusterNotReadyCondition(message string) toolchainv1alpha1.ToolchainClusterCondition {
 	currentTime := metav1.Now()
 	return toolchainv1alpha1.ToolchainClusterCondition{
 		Type:               toolchainv1alpha1.ToolchainClusterReady,
 		Status:             corev1.ConditionFalse,
 		Reason:             toolchainv1alpha1.ToolchainClusterClusterNotReadyReason,
-		Message:            healthzNotOk,
+		Message:            message,
 		LastProbeTime:      currentTime,
 		LastTransitionTime: &currentTime,
 	}
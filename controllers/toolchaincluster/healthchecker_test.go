@@ -2,7 +2,9 @@ package toolchaincluster
 
 import (
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
 	"github.com/codeready-toolchain/toolchain-common/pkg/cluster"
@@ -11,6 +13,9 @@ import (
 	"github.com/stretchr/testify/require"
 	"gopkg.in/h2non/gock.v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -40,11 +45,10 @@ func TestClusterHealthChecks(t *testing.T) {
 		stable, _ := newToolchainCluster("stable", "http://cluster.com", toolchainv1alpha1.ToolchainClusterStatus{})
 
 		cl := test.NewFakeClient(t, unstable, notFound, stable, sec)
-		reset := setupCachedClusters(t, cl, unstable, notFound, stable)
-		defer reset()
+		cache := setupCachedClusters(t, cl, unstable, notFound, stable)
 
 		// when
-		updateClusterStatuses(context.TODO(), "test-namespace", cl)
+		updateClusterStatuses(context.TODO(), cache, "test-namespace", cl)
 
 		// then
 		assertClusterStatus(t, cl, "unstable", notOffline(), unhealthy())
@@ -58,11 +62,10 @@ func TestClusterHealthChecks(t *testing.T) {
 		stable, _ := newToolchainCluster("stable", "http://cluster.com", withStatus(offline()))
 
 		cl := test.NewFakeClient(t, unstable, notFound, stable, sec)
-		resetCache := setupCachedClusters(t, cl, unstable, notFound, stable)
-		defer resetCache()
+		cache := setupCachedClusters(t, cl, unstable, notFound, stable)
 
 		// when
-		updateClusterStatuses(context.TODO(), "test-namespace", cl)
+		updateClusterStatuses(context.TODO(), cache, "test-namespace", cl)
 
 		// then
 		assertClusterStatus(t, cl, "unstable", notOffline(), unhealthy())
@@ -70,15 +73,29 @@ func TestClusterHealthChecks(t *testing.T) {
 		assertClusterStatus(t, cl, "stable", healthy())
 	})
 
+	t.Run("conditions not managed by the health checker are kept", func(t *testing.T) {
+		stable, sec := newToolchainCluster("stable", "http://cluster.com", withStatus(offline(), configurationValid()))
+		failing, _ := newToolchainCluster("failing", "http://failing.com", withStatus(configurationValid()))
+
+		cl := test.NewFakeClient(t, stable, failing, sec)
+		cache := setupCachedClusters(t, cl, stable)
+
+		// when
+		updateClusterStatuses(context.TODO(), cache, "test-namespace", cl)
+
+		// then
+		assertClusterStatus(t, cl, "stable", healthy(), configurationValid())
+		assertClusterStatus(t, cl, "failing", offline(), configurationValid())
+	})
+
 	t.Run("if no zones nor region is retrieved, then keep the current", func(t *testing.T) {
 		stable, sec := newToolchainCluster("stable", "http://cluster.com", withStatus(offline()))
 
 		cl := test.NewFakeClient(t, stable, sec)
-		resetCache := setupCachedClusters(t, cl, stable)
-		defer resetCache()
+		cache := setupCachedClusters(t, cl, stable)
 
 		// when
-		updateClusterStatuses(context.TODO(), "test-namespace", cl)
+		updateClusterStatuses(context.TODO(), cache, "test-namespace", cl)
 
 		// then
 		assertClusterStatus(t, cl, "stable", healthy())
@@ -90,15 +107,16 @@ func TestClusterHealthChecks(t *testing.T) {
 		cl := test.NewFakeClient(t, stable, sec)
 
 		// when
-		updateClusterStatuses(context.TODO(), "test-namespace", cl)
+		updateClusterStatuses(context.TODO(), cluster.NewClusterCache(), "test-namespace", cl)
 
 		// then
 		assertClusterStatus(t, cl, "failing", offline())
 	})
 }
 
-func setupCachedClusters(t *testing.T, cl *test.FakeClient, clusters ...*toolchainv1alpha1.ToolchainCluster) func() {
-	service := cluster.NewToolchainClusterServiceWithClient(cl, logf.Log, "test-namespace", 0, func(config *rest.Config, options client.Options) (client.Client, error) {
+func setupCachedClusters(t *testing.T, cl *test.FakeClient, clusters ...*toolchainv1alpha1.ToolchainCluster) *cluster.ClusterCache {
+	cache := cluster.NewClusterCache()
+	service := cluster.NewToolchainClusterServiceWithCache(cache, cl, logf.Log, "test-namespace", 0, func(config *rest.Config, options client.Options) (client.Client, error) {
 		// make sure that insecure is false to make Gock mocking working properly
 		config.Insecure = false
 		return client.New(config, options)
@@ -106,15 +124,11 @@ func setupCachedClusters(t *testing.T, cl *test.FakeClient, clusters ...*toolcha
 	for _, clustr := range clusters {
 		err := service.AddOrUpdateToolchainCluster(clustr)
 		require.NoError(t, err)
-		tc, found := cluster.GetCachedToolchainCluster(clustr.Name)
+		tc, found := cache.GetCachedToolchainCluster(clustr.Name)
 		require.True(t, found)
 		tc.Client = test.NewFakeClient(t)
 	}
-	return func() {
-		for _, clustr := range clusters {
-			service.DeleteToolchainCluster(clustr.Name)
-		}
-	}
+	return cache
 }
 
 func withStatus(conditions ...toolchainv1alpha1.ToolchainClusterCondition) toolchainv1alpha1.ToolchainClusterStatus {
@@ -176,3 +190,150 @@ func notOffline() toolchainv1alpha1.ToolchainClusterCondition {
 		Message: "cluster is reachable",
 	}
 }
+func configurationValid() toolchainv1alpha1.ToolchainClusterCondition {
+	return toolchainv1alpha1.ToolchainClusterCondition{Type: ToolchainClusterConfigurationValid,
+		Status: corev1.ConditionTrue,
+		Reason: ToolchainClusterConfigurationValidReason,
+	}
+}
+
+func TestUpdateStatusConditions(t *testing.T) {
+	// given
+	defer gock.Off()
+	custom := toolchainv1alpha1.ToolchainClusterCondition{
+		Type:   "Custom",
+		Status: corev1.ConditionTrue,
+		Reason: "SetByOthers",
+	}
+
+	t.Run("conditions set by others after the cluster was read are kept", func(t *testing.T) {
+		// given
+		stable, sec := newToolchainCluster("stable", "http://cluster.com", withStatus(offline()))
+		cl := test.NewFakeClient(t, stable, sec)
+		stale := &toolchainv1alpha1.ToolchainCluster{}
+		require.NoError(t, cl.Get(context.TODO(), test.NamespacedName("test-namespace", "stable"), stale))
+		latest := stale.DeepCopy()
+		latest.Status.Conditions = append(latest.Status.Conditions, custom)
+		require.NoError(t, cl.Status().Update(context.TODO(), latest))
+		patches := 0
+		cl.MockStatusPatch = func(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			patches++
+			return cl.Client.Status().Patch(ctx, obj, patch, opts...)
+		}
+
+		// when
+		err := updateStatusConditions(context.TODO(), cl, stale, []toolchainv1alpha1.ToolchainClusterCondition{healthy()}, 0)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 2, patches)
+		assertClusterStatus(t, cl, "stable", healthy(), custom)
+	})
+
+	t.Run("conflicts are retried", func(t *testing.T) {
+		// given
+		stable, sec := newToolchainCluster("stable", "http://cluster.com", withStatus(offline(), custom))
+		cl := test.NewFakeClient(t, stable, sec)
+		patches := 0
+		cl.MockStatusPatch = func(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			patches++
+			if patches < 3 {
+				return apierrors.NewConflict(schema.GroupResource{}, obj.GetName(), fmt.Errorf("conflict"))
+			}
+			return cl.Client.Status().Patch(ctx, obj, patch, opts...)
+		}
+
+		// when
+		err := updateStatusConditions(context.TODO(), cl, stable, []toolchainv1alpha1.ToolchainClusterCondition{healthy()}, 0)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 3, patches)
+		assertClusterStatus(t, cl, "stable", healthy(), custom)
+	})
+
+	t.Run("other errors are returned", func(t *testing.T) {
+		// given
+		stable, sec := newToolchainCluster("stable", "http://cluster.com", withStatus(offline()))
+		cl := test.NewFakeClient(t, stable, sec)
+		cl.MockStatusPatch = func(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			return fmt.Errorf("some error")
+		}
+
+		// when
+		err := updateStatusConditions(context.TODO(), cl, stable, []toolchainv1alpha1.ToolchainClusterCondition{healthy()}, 0)
+
+		// then
+		require.EqualError(t, err, "some error")
+	})
+
+	t.Run("heartbeat", func(t *testing.T) {
+		recently := metav1.NewTime(time.Now().Add(-time.Second))
+		longAgo := metav1.NewTime(time.Now().Add(-time.Hour))
+		probedAt := func(condition toolchainv1alpha1.ToolchainClusterCondition, probeTime metav1.Time) toolchainv1alpha1.ToolchainClusterCondition {
+			condition.LastProbeTime = probeTime
+			return condition
+		}
+
+		for name, tc := range map[string]struct {
+			previous      []toolchainv1alpha1.ToolchainClusterCondition
+			conditions    []toolchainv1alpha1.ToolchainClusterCondition
+			heartbeat     time.Duration
+			expectedPatch bool
+		}{
+			"not patched when only the probe time changed within the heartbeat": {
+				previous:      []toolchainv1alpha1.ToolchainClusterCondition{probedAt(unhealthy(), recently), probedAt(notOffline(), recently), custom},
+				conditions:    []toolchainv1alpha1.ToolchainClusterCondition{unhealthy(), notOffline()},
+				heartbeat:     time.Minute,
+				expectedPatch: false,
+			},
+			"patched when the heartbeat interval elapsed": {
+				previous:      []toolchainv1alpha1.ToolchainClusterCondition{probedAt(healthy(), longAgo), custom},
+				conditions:    []toolchainv1alpha1.ToolchainClusterCondition{healthy()},
+				heartbeat:     time.Minute,
+				expectedPatch: true,
+			},
+			"not patched when only the message changed within the heartbeat": {
+				previous:      []toolchainv1alpha1.ToolchainClusterCondition{probedAt(healthy(), recently), probedAt(degraded("1 of the last 2 health checks failed"), recently)},
+				conditions:    []toolchainv1alpha1.ToolchainClusterCondition{readyWithMessage("changed"), degraded("1 of the last 3 health checks failed")},
+				heartbeat:     time.Minute,
+				expectedPatch: false,
+			},
+			"patched when the status changed": {
+				previous:      []toolchainv1alpha1.ToolchainClusterCondition{probedAt(healthy(), recently)},
+				conditions:    []toolchainv1alpha1.ToolchainClusterCondition{unhealthy(), notOffline()},
+				heartbeat:     time.Minute,
+				expectedPatch: true,
+			},
+			"patched when a condition was removed": {
+				previous:      []toolchainv1alpha1.ToolchainClusterCondition{probedAt(healthy(), recently), probedAt(degraded("1 of the last 2 health checks failed"), recently)},
+				conditions:    []toolchainv1alpha1.ToolchainClusterCondition{healthy()},
+				heartbeat:     time.Minute,
+				expectedPatch: true,
+			},
+			"always patched without heartbeat": {
+				previous:      []toolchainv1alpha1.ToolchainClusterCondition{probedAt(healthy(), recently)},
+				conditions:    []toolchainv1alpha1.ToolchainClusterCondition{healthy()},
+				expectedPatch: true,
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				// given
+				stable, sec := newToolchainCluster("stable", "http://cluster.com", withStatus(tc.previous...))
+				cl := test.NewFakeClient(t, stable, sec)
+				patched := false
+				cl.MockStatusPatch = func(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+					patched = true
+					return cl.Client.Status().Patch(ctx, obj, patch, opts...)
+				}
+
+				// when
+				err := updateStatusConditions(context.TODO(), cl, stable, tc.conditions, tc.heartbeat)
+
+				// then
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedPatch, patched)
+			})
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package toolchaincluster
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/codeready-toolchain/toolchain-common/pkg/cluster"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// HealthChecksReadyzCheckName is the name of the readiness check of the health checks registered in the manager
+const HealthChecksReadyzCheckName = "toolchaincluster-health-checks"
+
+// HealthCheckRunner runs the periodic health checks of all ToolchainClusters. It implements manager.Runnable, so it's started
+// by the manager, and manager.LeaderElectionRunnable, so only the leader replica checks the clusters and updates their statuses.
+type HealthCheckRunner struct {
+	client    client.Client
+	cache     *cluster.ClusterCache
+	namespace string
+	period    time.Duration
+	config    *healthCheckConfig
+
+	lock sync.RWMutex
+	// started is the time when the runner was started - it's zero if it's not running
+	started time.Time
+	// lastCycle is the time when the last cycle of the health checks of all clusters was completed
+	lastCycle time.Time
+}
+
+var _ manager.Runnable = &HealthCheckRunner{}
+var _ manager.LeaderElectionRunnable = &HealthCheckRunner{}
+
+// NewHealthCheckRunner creates a new HealthCheckRunner that checks all ToolchainClusters in the given namespace with the given period.
+// The clients of the remote clusters are retrieved from the given cluster cache.
+func NewHealthCheckRunner(cl client.Client, cache *cluster.ClusterCache, namespace string, period time.Duration, options ...HealthCheckOption) *HealthCheckRunner {
+	options = append([]HealthCheckOption{WithClusterCheckTimeout(period)}, options...)
+	config := newHealthCheckConfig(options...)
+	// the status is written in the first check that completes after the heartbeat elapses - as the next cycle starts one period
+	// after the previous one is completed, then the probe time is up to heartbeat + period + cluster check timeout old
+	if maxHeartbeat := config.statusStaleAfter - period - config.clusterCheckTimeout; config.statusHeartbeat > maxHeartbeat {
+		config.statusHeartbeat = maxHeartbeat
+	}
+	if config.statusHeartbeat < 0 {
+		config.statusHeartbeat = 0
+	}
+	return &HealthCheckRunner{
+		client:    cl,
+		cache:     cache,
+		namespace: namespace,
+		period:    period,
+		config:    config,
+	}
+}
+
+// AddHealthChecks creates a HealthCheckRunner, adds it to the given manager and registers its readiness check in the manager
+func AddHealthChecks(mgr manager.Manager, cache *cluster.ClusterCache, namespace string, period time.Duration, options ...HealthCheckOption) (*HealthCheckRunner, error) {
+	runner := NewHealthCheckRunner(mgr.GetClient(), cache, namespace, period, options...)
+	if err := mgr.Add(runner); err != nil {
+		return nil, err
+	}
+	if err := mgr.AddReadyzCheck(HealthChecksReadyzCheckName, runner.ReadyzCheck); err != nil {
+		return nil, err
+	}
+	return runner, nil
+}
+
+// Start runs the health checks until the given context is done. It returns when the cycle that is in progress is completed.
+func (r *HealthCheckRunner) Start(ctx context.Context) error {
+	logger.Info("starting health checks", "period", r.period, "probes", len(r.config.probes),
+		"max-concurrent-checks", r.config.maxConcurrentChecks, "cluster-check-timeout", r.config.clusterCheckTimeout,
+		"failure-threshold", r.config.failureThreshold, "success-threshold", r.config.successThreshold, "status-heartbeat", r.config.statusHeartbeat)
+	r.lock.Lock()
+	r.started = time.Now()
+	r.lastCycle = time.Time{}
+	r.lock.Unlock()
+	defer func() {
+		r.lock.Lock()
+		r.started = time.Time{}
+		r.lock.Unlock()
+	}()
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		updateClusterStatusesWithConfig(ctx, r.cache, r.namespace, r.client, r.config)
+		r.lock.Lock()
+		r.lastCycle = time.Now()
+		r.lock.Unlock()
+	}, r.period)
+	logger.Info("health checks stopped")
+	return nil
+}
+
+// NeedLeaderElection returns true, so the health checks run only in the leader replica
+func (r *HealthCheckRunner) NeedLeaderElection() bool {
+	return true
+}
+
+// LastCycle returns the time when the last cycle of the health checks was completed, or zero time if there wasn't any
+func (r *HealthCheckRunner) LastCycle() time.Time {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.lastCycle
+}
+
+// ReadyzCheck is a healthz.Checker that fails when the runner is running, but no cycle of the health checks was completed
+// within twice the period. The check passes when the runner is not running (eg. in the replicas that are not the leader).
+func (r *HealthCheckRunner) ReadyzCheck(_ *http.Request) error {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if r.started.IsZero() {
+		return nil
+	}
+	last := r.lastCycle
+	if last.IsZero() {
+		last = r.started
+	}
+	if since := time.Since(last); since > 2*r.period {
+		return fmt.Errorf("no cycle of the health checks was completed in the last %s", since.Round(time.Millisecond))
+	}
+	return nil
+}
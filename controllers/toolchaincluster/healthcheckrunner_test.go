@@ -0,0 +1,192 @@
+package toolchaincluster
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/codeready-toolchain/toolchain-common/pkg/cluster"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/h2non/gock.v1"
+	kubeclientset "k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestHealthCheckRunner(t *testing.T) {
+	// given
+	defer gock.Off()
+	stable, sec := newToolchainCluster("stable", "http://cluster.com", withStatus(offline()))
+
+	t.Run("runs in the leader replica only", func(t *testing.T) {
+		// given
+		runner := NewHealthCheckRunner(test.NewFakeClient(t), cluster.NewClusterCache(), "test-namespace", time.Second)
+
+		// when
+		needLeaderElection := runner.NeedLeaderElection()
+
+		// then
+		assert.True(t, needLeaderElection)
+	})
+
+	t.Run("status heartbeat", func(t *testing.T) {
+		t.Run("is capped so the probe time doesn't get stale", func(t *testing.T) {
+			// when
+			runner := NewHealthCheckRunner(test.NewFakeClient(t), cluster.NewClusterCache(), "test-namespace", time.Second,
+				WithClusterCheckTimeout(3*time.Second), WithStatusHeartbeat(time.Hour, 10*time.Second))
+
+			// then
+			assert.Equal(t, 6*time.Second, runner.config.statusHeartbeat)
+		})
+
+		t.Run("is not capped when within the stale limit", func(t *testing.T) {
+			// when
+			runner := NewHealthCheckRunner(test.NewFakeClient(t), cluster.NewClusterCache(), "test-namespace", time.Second,
+				WithStatusHeartbeat(time.Minute, time.Hour))
+
+			// then
+			assert.Equal(t, time.Minute, runner.config.statusHeartbeat)
+		})
+
+		t.Run("is disabled when the stale limit is too short", func(t *testing.T) {
+			// when
+			runner := NewHealthCheckRunner(test.NewFakeClient(t), cluster.NewClusterCache(), "test-namespace", 10*time.Second,
+				WithStatusHeartbeat(time.Minute, 13*time.Second))
+
+			// then
+			assert.Zero(t, runner.config.statusHeartbeat)
+		})
+
+		t.Run("status is not written again in the next cycle", func(t *testing.T) {
+			// given
+			cl := test.NewFakeClient(t, stable.DeepCopy(), sec)
+			cache := setupCachedClusters(t, cl, stable)
+			var patches int32
+			cl.MockStatusPatch = func(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				atomic.AddInt32(&patches, 1)
+				return cl.Client.Status().Patch(ctx, obj, patch, opts...)
+			}
+			runner := NewHealthCheckRunner(cl, cache, "test-namespace", 10*time.Millisecond,
+				WithHealthProbes(&switchableProbe{healthy: true}), WithStatusHeartbeat(time.Minute, time.Hour))
+			ctx, cancel := context.WithCancel(context.TODO())
+			stopped := startRunner(ctx, runner)
+			defer func() {
+				cancel()
+				<-stopped
+			}()
+			require.Eventually(t, func() bool {
+				return !runner.LastCycle().IsZero()
+			}, 5*time.Second, time.Millisecond)
+			firstCycle := runner.LastCycle()
+			assertClusterStatus(t, cl, "stable", readyWithMessage("healthy"))
+			require.Equal(t, int32(1), atomic.LoadInt32(&patches))
+
+			// when
+			require.Eventually(t, func() bool {
+				return runner.LastCycle().After(firstCycle)
+			}, 5*time.Second, time.Millisecond)
+
+			// then
+			assert.Equal(t, int32(1), atomic.LoadInt32(&patches))
+		})
+	})
+
+	t.Run("is ready when not started", func(t *testing.T) {
+		// given
+		runner := NewHealthCheckRunner(test.NewFakeClient(t), cluster.NewClusterCache(), "test-namespace", time.Millisecond)
+
+		// when
+		err := runner.ReadyzCheck(nil)
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, runner.LastCycle().IsZero())
+	})
+
+	t.Run("checks the clusters until the context is cancelled", func(t *testing.T) {
+		// given
+		cl := test.NewFakeClient(t, stable.DeepCopy(), sec)
+		cache := setupCachedClusters(t, cl, stable)
+		runner := NewHealthCheckRunner(cl, cache, "test-namespace", 10*time.Millisecond, WithHealthProbes(&switchableProbe{healthy: true}))
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+
+		// when
+		stopped := startRunner(ctx, runner)
+
+		// then
+		require.Eventually(t, func() bool {
+			return !runner.LastCycle().IsZero()
+		}, 5*time.Second, time.Millisecond)
+		assertClusterStatus(t, cl, "stable", readyWithMessage("healthy"))
+		require.NoError(t, runner.ReadyzCheck(nil))
+
+		// when
+		cancel()
+
+		// then
+		select {
+		case err := <-stopped:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "the runner didn't stop after the context was cancelled")
+		}
+		require.NoError(t, runner.ReadyzCheck(nil))
+	})
+
+	t.Run("is not ready when no cycle is completed within twice the period", func(t *testing.T) {
+		// given
+		cl := test.NewFakeClient(t, stable.DeepCopy(), sec)
+		cache := setupCachedClusters(t, cl, stable)
+		probe := &blockingProbe{release: make(chan struct{})}
+		runner := NewHealthCheckRunner(cl, cache, "test-namespace", 10*time.Millisecond, WithHealthProbes(probe))
+		ctx, cancel := context.WithCancel(context.TODO())
+		stopped := startRunner(ctx, runner)
+		defer func() {
+			cancel()
+			<-stopped
+		}()
+
+		// when
+		require.Eventually(t, func() bool {
+			return runner.ReadyzCheck(nil) != nil
+		}, 5*time.Second, time.Millisecond)
+
+		// then
+		assert.Contains(t, runner.ReadyzCheck(nil).Error(), "no cycle of the health checks was completed in the last")
+		assert.True(t, runner.LastCycle().IsZero())
+
+		// when
+		close(probe.release)
+
+		// then
+		require.Eventually(t, func() bool {
+			return runner.ReadyzCheck(nil) == nil
+		}, 5*time.Second, time.Millisecond)
+		assert.False(t, runner.LastCycle().IsZero())
+	})
+}
+
+func startRunner(ctx context.Context, runner *HealthCheckRunner) <-chan error {
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- runner.Start(ctx)
+	}()
+	return stopped
+}
+
+// blockingProbe blocks (regardless of the context) until it's released
+type blockingProbe struct {
+	release chan struct{}
+}
+
+func (p *blockingProbe) Name() string {
+	return "blocking"
+}
+
+func (p *blockingProbe) Probe(_ context.Context, _ *cluster.CachedToolchainCluster, _ kubeclientset.Interface) HealthProbeResult {
+	<-p.release
+	return HealthProbeResult{Healthy: true}
+}
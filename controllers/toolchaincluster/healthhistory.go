@@ -0,0 +1,120 @@
+package toolchaincluster
+
+import (
+	"fmt"
+	"sync"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/toolchain-common/pkg/cluster"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ToolchainClusterDegraded is the type of the condition that is set when the recent health checks of the cluster
+	// both failed and succeeded, ie. when the cluster is flaky. The condition is removed when the cluster becomes stable again.
+	ToolchainClusterDegraded toolchainv1alpha1.ToolchainClusterConditionType = "Degraded"
+	// ToolchainClusterFlappingReason is the reason of the Degraded condition
+	ToolchainClusterFlappingReason = "ClusterFlapping"
+
+	// probeHistorySize is the number of the last results of the health checks that are kept for every cluster
+	probeHistorySize = 10
+)
+
+// healthHistory keeps the results of the last health checks of the clusters
+type healthHistory struct {
+	sync.Mutex
+	results map[string][]bool
+}
+
+func newHealthHistory() *healthHistory {
+	return &healthHistory{
+		results: map[string][]bool{},
+	}
+}
+
+// record adds the result of the health check of the given cluster to the history and returns a copy of the history of the cluster
+func (h *healthHistory) record(clusterName string, healthy bool) []bool {
+	h.Lock()
+	defer h.Unlock()
+	results := append(h.results[clusterName], healthy)
+	if len(results) > probeHistorySize {
+		results = results[len(results)-probeHistorySize:]
+	}
+	h.results[clusterName] = results
+	return append([]bool(nil), results...)
+}
+
+// retain removes the history of all clusters except for the given ones
+func (h *healthHistory) retain(clusterNames map[string]bool) {
+	h.Lock()
+	defer h.Unlock()
+	for name := range h.results {
+		if !clusterNames[name] {
+			delete(h.results, name)
+		}
+	}
+}
+
+// consecutive returns the number of the last results that are equal to the last one
+func consecutive(results []bool) int {
+	count := 0
+	for i := len(results) - 1; i >= 0 && results[i] == results[len(results)-1]; i-- {
+		count++
+	}
+	return count
+}
+
+// dampedConditions returns the Ready and Offline conditions that should be set in the status of the cluster.
+// The readiness of the cluster changes only after the given number of consecutive failures (when the cluster is ready)
+// or successes (when it's not ready) - until then the previous conditions are kept, only their probe time is updated.
+func dampedConditions(previous, current []toolchainv1alpha1.ToolchainClusterCondition, results []bool, failureThreshold, successThreshold int) []toolchainv1alpha1.ToolchainClusterCondition {
+	var previousReadiness []toolchainv1alpha1.ToolchainClusterCondition
+	for _, condition := range previous {
+		if condition.Type == toolchainv1alpha1.ToolchainClusterReady || condition.Type == toolchainv1alpha1.ToolchainClusterOffline {
+			previousReadiness = append(previousReadiness, condition)
+		}
+	}
+	if len(previousReadiness) == 0 || len(results) == 0 {
+		return current
+	}
+	wasReady := cluster.IsReady(&toolchainv1alpha1.ToolchainClusterStatus{Conditions: previousReadiness})
+	healthy := results[len(results)-1]
+	if healthy == wasReady {
+		return current
+	}
+	threshold := successThreshold
+	if wasReady {
+		threshold = failureThreshold
+	}
+	if consecutive(results) >= threshold {
+		return current
+	}
+	now := metav1.Now()
+	for i := range previousReadiness {
+		previousReadiness[i].LastProbeTime = now
+	}
+	return previousReadiness
+}
+
+// degradedCondition returns the Degraded condition if the given history contains both failed and successful health checks
+func degradedCondition(results []bool) (toolchainv1alpha1.ToolchainClusterCondition, bool) {
+	failures := 0
+	for _, healthy := range results {
+		if !healthy {
+			failures++
+		}
+	}
+	if failures == 0 || failures == len(results) {
+		return toolchainv1alpha1.ToolchainClusterCondition{}, false
+	}
+	currentTime := metav1.Now()
+	return toolchainv1alpha1.ToolchainClusterCondition{
+		Type:               ToolchainClusterDegraded,
+		Status:             corev1.ConditionTrue,
+		Reason:             ToolchainClusterFlappingReason,
+		Message:            fmt.Sprintf("%d of the last %d health checks failed", failures, len(results)),
+		LastProbeTime:      currentTime,
+		LastTransitionTime: &currentTime,
+	}, true
+}
@@ -0,0 +1,161 @@
+package toolchaincluster
+
+import (
+	"context"
+	"testing"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/toolchain-common/pkg/cluster"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+	corev1 "k8s.io/api/core/v1"
+	kubeclientset "k8s.io/client-go/kubernetes"
+)
+
+func TestClusterHealthChecksWithReadinessThresholds(t *testing.T) {
+	// given
+	defer gock.Off()
+	flaky, sec := newToolchainCluster("flaky", "http://cluster.com", withStatus(healthy(), configurationValid()))
+	cl := test.NewFakeClient(t, flaky, sec)
+	cache := setupCachedClusters(t, cl, flaky)
+	probe := &switchableProbe{}
+	config := newHealthCheckConfig(WithHealthProbes(probe), WithReadinessThresholds(3, 2))
+	notReady := unhealthy()
+	notReady.Message = "unhealthy"
+
+	check := func(healthy bool) {
+		probe.healthy = healthy
+		updateClusterStatusesWithConfig(context.TODO(), cache, "test-namespace", cl, config)
+	}
+
+	t.Run("ready cluster stays ready until the failure threshold is reached", func(t *testing.T) {
+		// when
+		check(false)
+		check(false)
+
+		// then
+		assertClusterStatus(t, cl, "flaky", healthy(), configurationValid())
+	})
+
+	t.Run("ready cluster becomes not ready when the failure threshold is reached", func(t *testing.T) {
+		// when
+		check(false)
+
+		// then
+		assertClusterStatus(t, cl, "flaky", notReady, notOffline(), configurationValid())
+	})
+
+	t.Run("not ready cluster stays not ready until the success threshold is reached", func(t *testing.T) {
+		// when
+		check(true)
+
+		// then
+		assertClusterStatus(t, cl, "flaky", notReady, notOffline(), configurationValid(), degraded("3 of the last 4 health checks failed"))
+	})
+
+	t.Run("not ready cluster becomes ready when the success threshold is reached", func(t *testing.T) {
+		// when
+		check(true)
+
+		// then
+		assertClusterStatus(t, cl, "flaky", readyWithMessage("healthy"), configurationValid(), degraded("3 of the last 5 health checks failed"))
+	})
+
+	t.Run("single failure doesn't change the readiness", func(t *testing.T) {
+		// when
+		check(false)
+
+		// then
+		assertClusterStatus(t, cl, "flaky", readyWithMessage("healthy"), configurationValid(), degraded("4 of the last 6 health checks failed"))
+	})
+
+	t.Run("degraded condition is removed when all the recorded health checks succeeded", func(t *testing.T) {
+		// when
+		for i := 0; i < probeHistorySize-1; i++ {
+			check(true)
+		}
+
+		// then
+		assertClusterStatus(t, cl, "flaky", readyWithMessage("healthy"), configurationValid(), degraded("1 of the last 10 health checks failed"))
+
+		// when
+		check(true)
+
+		// then
+		assertClusterStatus(t, cl, "flaky", readyWithMessage("healthy"), configurationValid())
+	})
+}
+
+func TestHealthHistory(t *testing.T) {
+	t.Run("keeps only the last results", func(t *testing.T) {
+		// given
+		history := newHealthHistory()
+
+		// when
+		for i := 0; i < probeHistorySize+5; i++ {
+			history.record("east", i%2 == 0)
+		}
+		results := history.record("east", false)
+
+		// then
+		assert.Len(t, results, probeHistorySize)
+		assert.Equal(t, []bool{true, false, true, false, true, false, true, false, true, false}, results)
+	})
+
+	t.Run("returns a copy of the results", func(t *testing.T) {
+		// given
+		history := newHealthHistory()
+		results := history.record("east", true)
+
+		// when
+		results[0] = false
+
+		// then
+		assert.Equal(t, []bool{true, true}, history.record("east", true))
+	})
+
+	t.Run("retains only the given clusters", func(t *testing.T) {
+		// given
+		history := newHealthHistory()
+		history.record("east", true)
+		history.record("west", false)
+
+		// when
+		history.retain(map[string]bool{"east": true})
+
+		// then
+		assert.Equal(t, []bool{true, true}, history.record("east", true))
+		assert.Equal(t, []bool{true}, history.record("west", true))
+	})
+}
+
+func TestConsecutive(t *testing.T) {
+	assert.Equal(t, 0, consecutive(nil))
+	assert.Equal(t, 1, consecutive([]bool{true}))
+	assert.Equal(t, 3, consecutive([]bool{true, false, false, false}))
+	assert.Equal(t, 2, consecutive([]bool{false, true, true}))
+}
+
+type switchableProbe struct {
+	healthy bool
+}
+
+func (p *switchableProbe) Name() string {
+	return "switchable"
+}
+
+func (p *switchableProbe) Probe(_ context.Context, _ *cluster.CachedToolchainCluster, _ kubeclientset.Interface) HealthProbeResult {
+	if p.healthy {
+		return HealthProbeResult{Healthy: true, Message: "healthy"}
+	}
+	return HealthProbeResult{Message: "unhealthy"}
+}
+
+func degraded(message string) toolchainv1alpha1.ToolchainClusterCondition {
+	return toolchainv1alpha1.ToolchainClusterCondition{Type: ToolchainClusterDegraded,
+		Status:  corev1.ConditionTrue,
+		Reason:  ToolchainClusterFlappingReason,
+		Message: message,
+	}
+}
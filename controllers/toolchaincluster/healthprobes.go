@@ -0,0 +1,216 @@
+package toolchaincluster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/codeready-toolchain/toolchain-common/pkg/cluster"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
+	kubeclientset "k8s.io/client-go/kubernetes"
+)
+
+// DefaultMemberOperatorDeploymentName is the name of the deployment of the member operator
+const DefaultMemberOperatorDeploymentName = "member-operator-controller-manager"
+
+// HealthProbe checks one aspect of the health of a remote cluster
+type HealthProbe interface {
+	// Name is the name of the probe used in the logs
+	Name() string
+	// Probe checks the health of the given cluster using the given clientset of the cluster
+	Probe(ctx context.Context, cachedCluster *cluster.CachedToolchainCluster, clientset kubeclientset.Interface) HealthProbeResult
+}
+
+// HealthProbeResult is the result of a single health probe
+type HealthProbeResult struct {
+	// Healthy is true when the cluster passed the probe
+	Healthy bool
+	// Unreachable is true when the cluster couldn't be reached at all - such a cluster is marked as offline
+	Unreachable bool
+	// Message describes the result of the probe and is added to the message of the Ready condition
+	Message string
+	// Err is the error that caused the failure of the probe (if any). It's logged, but not added to the conditions.
+	Err error
+}
+
+// DefaultHealthProbes returns the probes used when no other probes are registered on the health checker
+func DefaultHealthProbes() []HealthProbe {
+	return []HealthProbe{HealthzProbe()}
+}
+
+// HealthzProbe returns a probe that requests "/healthz" and expects "ok" in the response
+func HealthzProbe() HealthProbe {
+	return healthzProbe{}
+}
+
+type healthzProbe struct{}
+
+func (p healthzProbe) Name() string {
+	return "healthz"
+}
+
+func (p healthzProbe) Probe(ctx context.Context, _ *cluster.CachedToolchainCluster, clientset kubeclientset.Interface) HealthProbeResult {
+	body, err := clientset.Discovery().RESTClient().Get().AbsPath("/healthz").Do(ctx).Raw()
+	if err != nil {
+		return HealthProbeResult{Unreachable: true, Message: clusterNotReachableMsg, Err: err}
+	}
+	if !strings.EqualFold(string(body), "ok") {
+		return HealthProbeResult{Message: healthzNotOk}
+	}
+	return HealthProbeResult{Healthy: true, Message: healthzOk}
+}
+
+// ReadyzProbe returns a probe that requests "/readyz?verbose" and reports the individual checks that failed
+func ReadyzProbe() HealthProbe {
+	return readyzProbe{}
+}
+
+type readyzProbe struct{}
+
+func (p readyzProbe) Name() string {
+	return "readyz"
+}
+
+func (p readyzProbe) Probe(ctx context.Context, _ *cluster.CachedToolchainCluster, clientset kubeclientset.Interface) HealthProbeResult {
+	// the body is returned also when the API server responds with an error status code (ie. when some of the checks failed)
+	body, err := clientset.Discovery().RESTClient().Get().AbsPath("/readyz").Param("verbose", "").Do(ctx).Raw()
+	passed, failed := parseVerboseChecks(string(body))
+	if err != nil && len(passed)+len(failed) == 0 {
+		return HealthProbeResult{Unreachable: true, Message: clusterNotReachableMsg, Err: err}
+	}
+	if len(failed) > 0 {
+		return HealthProbeResult{Message: fmt.Sprintf("/readyz checks failed: %s", strings.Join(failed, ", "))}
+	}
+	if err != nil {
+		return HealthProbeResult{Message: fmt.Sprintf("/readyz failed: %s", err), Err: err}
+	}
+	return HealthProbeResult{Healthy: true, Message: fmt.Sprintf("/readyz passed %d checks", len(passed))}
+}
+
+// parseVerboseChecks parses the verbose output of the /readyz or /livez endpoints, where each check is on a separate line,
+// eg. "[+]ping ok" or "[-]etcd failed: reason withheld". Returns the names of the checks that passed and that failed.
+func parseVerboseChecks(body string) ([]string, []string) {
+	var passed, failed []string
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "[+]"):
+			passed = append(passed, checkName(line))
+		case strings.HasPrefix(line, "[-]"):
+			failed = append(failed, checkName(line))
+		}
+	}
+	return passed, failed
+}
+
+func checkName(line string) string {
+	return strings.Fields(line[3:] + " ")[0]
+}
+
+// VersionSkewProbe returns a probe that verifies that the minor version of the API server of the cluster
+// doesn't differ from the version of the host cluster by more than the given number of minor versions.
+// The version of the host cluster is retrieved using the given discovery client of the host cluster in each probe,
+// so the probe follows the upgrades of the host cluster.
+func VersionSkewProbe(hostDiscovery discovery.ServerVersionInterface, maxMinorSkew uint) HealthProbe {
+	return versionSkewProbe{
+		hostDiscovery: hostDiscovery,
+		maxMinorSkew:  maxMinorSkew,
+	}
+}
+
+type versionSkewProbe struct {
+	hostDiscovery discovery.ServerVersionInterface
+	maxMinorSkew  uint
+}
+
+func (p versionSkewProbe) Name() string {
+	return "version-skew"
+}
+
+func (p versionSkewProbe) Probe(_ context.Context, _ *cluster.CachedToolchainCluster, clientset kubeclientset.Interface) HealthProbeResult {
+	hostInfo, err := p.hostDiscovery.ServerVersion()
+	if err != nil {
+		return HealthProbeResult{Message: "unable to get the version of the host cluster", Err: err}
+	}
+	hostVersion, err := version.ParseGeneric(hostInfo.GitVersion)
+	if err != nil {
+		return HealthProbeResult{Message: fmt.Sprintf("unable to parse the version of the host cluster %q", hostInfo.GitVersion), Err: err}
+	}
+	info, err := clientset.Discovery().ServerVersion()
+	if err != nil {
+		return HealthProbeResult{Unreachable: true, Message: clusterNotReachableMsg, Err: err}
+	}
+	clusterVersion, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return HealthProbeResult{Message: fmt.Sprintf("unable to parse the version of the cluster %q", info.GitVersion), Err: err}
+	}
+	skew := int(clusterVersion.Minor()) - int(hostVersion.Minor())
+	if skew < 0 {
+		skew = -skew
+	}
+	if clusterVersion.Major() != hostVersion.Major() || uint(skew) > p.maxMinorSkew {
+		return HealthProbeResult{Message: fmt.Sprintf("the version %s of the cluster is not compatible with the version %s of the host cluster", info.GitVersion, hostInfo.GitVersion)}
+	}
+	return HealthProbeResult{Healthy: true, Message: fmt.Sprintf("the version %s of the cluster is compatible with the host cluster", info.GitVersion)}
+}
+
+// MemberOperatorDeploymentProbe returns a probe that verifies that the deployment of the member operator with the given name
+// is available in the operator namespace of the cluster. The probe is skipped for clusters that are not members.
+func MemberOperatorDeploymentProbe(deploymentName string) HealthProbe {
+	return memberOperatorDeploymentProbe{deploymentName: deploymentName}
+}
+
+type memberOperatorDeploymentProbe struct {
+	deploymentName string
+}
+
+func (p memberOperatorDeploymentProbe) Name() string {
+	return "member-operator-deployment"
+}
+
+func (p memberOperatorDeploymentProbe) Probe(ctx context.Context, cachedCluster *cluster.CachedToolchainCluster, clientset kubeclientset.Interface) HealthProbeResult {
+	if cachedCluster.Type != cluster.Member {
+		return HealthProbeResult{Healthy: true}
+	}
+	deployment, err := clientset.AppsV1().Deployments(cachedCluster.OperatorNamespace).Get(ctx, p.deploymentName, metav1.GetOptions{})
+	if err != nil {
+		return HealthProbeResult{Message: fmt.Sprintf("unable to get the deployment %s/%s: %s", cachedCluster.OperatorNamespace, p.deploymentName, err), Err: err}
+	}
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentAvailable && condition.Status == corev1.ConditionTrue {
+			return HealthProbeResult{Healthy: true, Message: fmt.Sprintf("the deployment %s/%s is available", cachedCluster.OperatorNamespace, p.deploymentName)}
+		}
+	}
+	return HealthProbeResult{Message: fmt.Sprintf("the deployment %s/%s is not available", cachedCluster.OperatorNamespace, p.deploymentName)}
+}
+
+// LatencyProbe returns a probe that measures the round-trip latency of a request to "/version"
+// and fails when the latency exceeds the given threshold
+func LatencyProbe(threshold time.Duration) HealthProbe {
+	return latencyProbe{threshold: threshold}
+}
+
+type latencyProbe struct {
+	threshold time.Duration
+}
+
+func (p latencyProbe) Name() string {
+	return "latency"
+}
+
+func (p latencyProbe) Probe(ctx context.Context, _ *cluster.CachedToolchainCluster, clientset kubeclientset.Interface) HealthProbeResult {
+	start := time.Now()
+	if err := clientset.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Error(); err != nil {
+		return HealthProbeResult{Unreachable: true, Message: clusterNotReachableMsg, Err: err}
+	}
+	latency := time.Since(start).Round(time.Millisecond)
+	if latency > p.threshold {
+		return HealthProbeResult{Message: fmt.Sprintf("the round-trip latency %s exceeds %s", latency, p.threshold)}
+	}
+	return HealthProbeResult{Healthy: true, Message: fmt.Sprintf("the round-trip latency is %s", latency)}
+}
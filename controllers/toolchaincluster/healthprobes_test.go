@@ -0,0 +1,451 @@
+package toolchaincluster
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/toolchain-common/pkg/cluster"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/h2non/gock.v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery"
+	kubeclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestReadyzProbe(t *testing.T) {
+	// given
+	cachedCluster := newCachedMember()
+
+	t.Run("all checks passed", func(t *testing.T) {
+		// given
+		clientset := newClientset(t, respondWith(http.StatusOK, "[+]ping ok\n[+]log ok\nreadyz check passed"))
+
+		// when
+		result := ReadyzProbe().Probe(context.TODO(), cachedCluster, clientset)
+
+		// then
+		assert.Equal(t, HealthProbeResult{Healthy: true, Message: "/readyz passed 2 checks"}, result)
+	})
+
+	t.Run("some checks failed", func(t *testing.T) {
+		// given
+		clientset := newClientset(t, respondWith(http.StatusInternalServerError, "[+]ping ok\n[-]etcd failed: reason withheld\n[-]informer-sync failed: reason withheld\nreadyz check failed"))
+
+		// when
+		result := ReadyzProbe().Probe(context.TODO(), cachedCluster, clientset)
+
+		// then
+		assert.Equal(t, HealthProbeResult{Message: "/readyz checks failed: etcd, informer-sync"}, result)
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		// given
+		clientset := newUnreachableClientset(t)
+
+		// when
+		result := ReadyzProbe().Probe(context.TODO(), cachedCluster, clientset)
+
+		// then
+		assert.True(t, result.Unreachable)
+		assert.False(t, result.Healthy)
+	})
+}
+
+func TestVersionSkewProbe(t *testing.T) {
+	// given
+	cachedCluster := newCachedMember()
+	clientset := newClientset(t, respondWith(http.StatusOK, `{"major":"1","minor":"25","gitVersion":"v1.25.3"}`))
+	hostDiscovery := func(t *testing.T, hostVersion string) discovery.ServerVersionInterface {
+		return newClientset(t, respondWith(http.StatusOK, fmt.Sprintf(`{"gitVersion":%q}`, hostVersion))).Discovery()
+	}
+
+	t.Run("compatible version", func(t *testing.T) {
+		for _, hostVersion := range []string{"v1.24.0", "v1.25.1", "v1.26.7"} {
+			// when
+			result := VersionSkewProbe(hostDiscovery(t, hostVersion), 1).Probe(context.TODO(), cachedCluster, clientset)
+
+			// then
+			assert.Equal(t, HealthProbeResult{Healthy: true, Message: "the version v1.25.3 of the cluster is compatible with the host cluster"}, result)
+		}
+	})
+
+	t.Run("incompatible version", func(t *testing.T) {
+		for _, hostVersion := range []string{"v1.23.0", "v1.27.0", "v2.25.3"} {
+			// when
+			result := VersionSkewProbe(hostDiscovery(t, hostVersion), 1).Probe(context.TODO(), cachedCluster, clientset)
+
+			// then
+			assert.Equal(t, HealthProbeResult{Message: "the version v1.25.3 of the cluster is not compatible with the version " + hostVersion + " of the host cluster"}, result)
+		}
+	})
+
+	t.Run("invalid host version", func(t *testing.T) {
+		// when
+		result := VersionSkewProbe(hostDiscovery(t, "unknown"), 1).Probe(context.TODO(), cachedCluster, clientset)
+
+		// then
+		assert.False(t, result.Healthy)
+		assert.Equal(t, `unable to parse the version of the host cluster "unknown"`, result.Message)
+		assert.Error(t, result.Err)
+	})
+
+	t.Run("host version not available", func(t *testing.T) {
+		// when
+		result := VersionSkewProbe(newUnreachableClientset(t).Discovery(), 1).Probe(context.TODO(), cachedCluster, clientset)
+
+		// then
+		assert.False(t, result.Healthy)
+		assert.False(t, result.Unreachable)
+		assert.Equal(t, "unable to get the version of the host cluster", result.Message)
+		assert.Error(t, result.Err)
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		// when
+		result := VersionSkewProbe(hostDiscovery(t, "v1.25.0"), 1).Probe(context.TODO(), cachedCluster, newUnreachableClientset(t))
+
+		// then
+		assert.True(t, result.Unreachable)
+		assert.Error(t, result.Err)
+	})
+}
+
+func TestMemberOperatorDeploymentProbe(t *testing.T) {
+	// given
+	deploymentPath := "/apis/apps/v1/namespaces/toolchain-member-operator/deployments/member-operator-controller-manager"
+	deployment := func(available corev1.ConditionStatus) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != deploymentPath {
+				respondWith(http.StatusNotFound, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`)(w, r)
+				return
+			}
+			respondWith(http.StatusOK, `{"apiVersion":"apps/v1","kind":"Deployment","status":{"conditions":[{"type":"Available","status":"`+string(available)+`"}]}}`)(w, r)
+		}
+	}
+
+	t.Run("available", func(t *testing.T) {
+		// when
+		result := MemberOperatorDeploymentProbe(DefaultMemberOperatorDeploymentName).Probe(context.TODO(), newCachedMember(), newClientset(t, deployment(corev1.ConditionTrue)))
+
+		// then
+		assert.Equal(t, HealthProbeResult{Healthy: true, Message: "the deployment toolchain-member-operator/member-operator-controller-manager is available"}, result)
+	})
+
+	t.Run("not available", func(t *testing.T) {
+		// when
+		result := MemberOperatorDeploymentProbe(DefaultMemberOperatorDeploymentName).Probe(context.TODO(), newCachedMember(), newClientset(t, deployment(corev1.ConditionFalse)))
+
+		// then
+		assert.Equal(t, HealthProbeResult{Message: "the deployment toolchain-member-operator/member-operator-controller-manager is not available"}, result)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		// when
+		result := MemberOperatorDeploymentProbe("unknown").Probe(context.TODO(), newCachedMember(), newClientset(t, deployment(corev1.ConditionTrue)))
+
+		// then
+		assert.False(t, result.Healthy)
+		assert.Contains(t, result.Message, "unable to get the deployment toolchain-member-operator/unknown")
+	})
+
+	t.Run("skipped for host", func(t *testing.T) {
+		// given
+		host := newCachedMember()
+		host.Type = cluster.Host
+
+		// when
+		result := MemberOperatorDeploymentProbe(DefaultMemberOperatorDeploymentName).Probe(context.TODO(), host, newUnreachableClientset(t))
+
+		// then
+		assert.Equal(t, HealthProbeResult{Healthy: true}, result)
+	})
+}
+
+func TestLatencyProbe(t *testing.T) {
+	// given
+	cachedCluster := newCachedMember()
+	clientset := newClientset(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		respondWith(http.StatusOK, `{"gitVersion":"v1.25.3"}`)(w, r)
+	})
+
+	t.Run("below threshold", func(t *testing.T) {
+		// when
+		result := LatencyProbe(time.Minute).Probe(context.TODO(), cachedCluster, clientset)
+
+		// then
+		assert.True(t, result.Healthy)
+		assert.Contains(t, result.Message, "the round-trip latency is ")
+	})
+
+	t.Run("above threshold", func(t *testing.T) {
+		// when
+		result := LatencyProbe(time.Millisecond).Probe(context.TODO(), cachedCluster, clientset)
+
+		// then
+		assert.False(t, result.Healthy)
+		assert.Contains(t, result.Message, "exceeds 1ms")
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		// when
+		result := LatencyProbe(time.Minute).Probe(context.TODO(), cachedCluster, newUnreachableClientset(t))
+
+		// then
+		assert.True(t, result.Unreachable)
+	})
+}
+
+func TestClusterHealthChecksWithProbes(t *testing.T) {
+	// given
+	defer gock.Off()
+	gock.New("http://cluster.com").
+		Get("healthz").
+		Persist().
+		Reply(200).
+		BodyString("ok")
+	stable, sec := newToolchainCluster("stable", "http://cluster.com", withStatus(offline()))
+	passing := fakeProbe{HealthProbeResult{Healthy: true, Message: "healthy"}}
+	failing := fakeProbe{HealthProbeResult{Message: "unhealthy"}}
+	unreachable := fakeProbe{HealthProbeResult{Unreachable: true, Message: "unreachable"}}
+	silent := fakeProbe{HealthProbeResult{Healthy: true}}
+
+	t.Run("all probes passed", func(t *testing.T) {
+		// given
+		cl := test.NewFakeClient(t, stable.DeepCopy(), sec)
+		cache := setupCachedClusters(t, cl, stable)
+
+		// when
+		updateClusterStatuses(context.TODO(), cache, "test-namespace", cl, WithHealthProbes(HealthzProbe(), passing, silent))
+
+		// then
+		assertClusterStatus(t, cl, "stable", readyWithMessage("/healthz responded with ok; healthy"))
+	})
+
+	t.Run("some probes failed", func(t *testing.T) {
+		// given
+		cl := test.NewFakeClient(t, stable.DeepCopy(), sec)
+		cache := setupCachedClusters(t, cl, stable)
+
+		// when
+		updateClusterStatuses(context.TODO(), cache, "test-namespace", cl, WithHealthProbes(failing, passing, failing))
+
+		// then
+		notReady := unhealthy()
+		notReady.Message = "unhealthy; unhealthy"
+		assertClusterStatus(t, cl, "stable", notReady, notOffline())
+	})
+
+	t.Run("cluster is unreachable", func(t *testing.T) {
+		// given
+		cl := test.NewFakeClient(t, stable.DeepCopy(), sec)
+		cache := setupCachedClusters(t, cl, stable)
+
+		// when
+		updateClusterStatuses(context.TODO(), cache, "test-namespace", cl, WithHealthProbes(passing, failing, unreachable))
+
+		// then
+		assertClusterStatus(t, cl, "stable", offline())
+	})
+}
+
+type fakeProbe struct {
+	result HealthProbeResult
+}
+
+func (p fakeProbe) Name() string {
+	return "fake"
+}
+
+func (p fakeProbe) Probe(_ context.Context, _ *cluster.CachedToolchainCluster, _ kubeclientset.Interface) HealthProbeResult {
+	return p.result
+}
+
+func readyWithMessage(message string) toolchainv1alpha1.ToolchainClusterCondition {
+	ready := healthy()
+	ready.Message = message
+	return ready
+}
+
+func newCachedMember() *cluster.CachedToolchainCluster {
+	return &cluster.CachedToolchainCluster{
+		Config: &cluster.Config{
+			Name:              "member",
+			Type:              cluster.Member,
+			OperatorNamespace: "toolchain-member-operator",
+		},
+	}
+}
+
+func respondWith(status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}
+}
+
+func newClientset(t *testing.T, handler http.HandlerFunc) kubeclientset.Interface {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	clientset, err := kubeclientset.NewForConfig(&rest.Config{Host: server.URL})
+	require.NoError(t, err)
+	return clientset
+}
+
+func newUnreachableClientset(t *testing.T) kubeclientset.Interface {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	clientset, err := kubeclientset.NewForConfig(&rest.Config{Host: server.URL})
+	require.NoError(t, err)
+	return clientset
+}
+
+func TestConcurrentClusterHealthChecks(t *testing.T) {
+	// given
+	defer gock.Off()
+	gock.New("http://cluster.com").
+		Get("healthz").
+		Persist().
+		Reply(200).
+		BodyString("ok")
+	var clusters []*toolchainv1alpha1.ToolchainCluster
+	var objs []runtime.Object
+	for i := 0; i < 6; i++ {
+		toolchainCluster, sec := newToolchainCluster(fmt.Sprintf("cluster-%d", i), "http://cluster.com", withStatus(offline()))
+		clusters = append(clusters, toolchainCluster)
+		objs = append(objs, toolchainCluster.DeepCopy())
+		if i == 0 {
+			// all the clusters share the same secret
+			objs = append(objs, sec)
+		}
+	}
+
+	t.Run("number of concurrent checks is limited", func(t *testing.T) {
+		// given
+		cl := test.NewFakeClient(t, objs...)
+		cache := setupCachedClusters(t, cl, clusters...)
+		probe := &concurrencyProbe{}
+
+		// when
+		updateClusterStatuses(context.TODO(), cache, "test-namespace", cl, WithHealthProbes(probe), WithMaxConcurrentHealthChecks(2))
+
+		// then
+		assert.Equal(t, 2, probe.maxRunning)
+		assert.Equal(t, 6, probe.calls)
+		for _, toolchainCluster := range clusters {
+			assertClusterStatus(t, cl, toolchainCluster.Name, readyWithMessage("healthy"))
+		}
+	})
+
+	t.Run("slow cluster doesn't delay the others", func(t *testing.T) {
+		// given
+		cl := test.NewFakeClient(t, objs...)
+		cache := setupCachedClusters(t, cl, clusters...)
+		probe := slowProbe{slowCluster: "cluster-0"}
+		start := time.Now()
+
+		// when
+		updateClusterStatuses(context.TODO(), cache, "test-namespace", cl, WithHealthProbes(probe), WithClusterCheckTimeout(100*time.Millisecond))
+
+		// then
+		assert.Less(t, time.Since(start), 5*time.Second)
+		assertClusterStatus(t, cl, "cluster-0", offline())
+		for _, toolchainCluster := range clusters[1:] {
+			assertClusterStatus(t, cl, toolchainCluster.Name, readyWithMessage("healthy"))
+		}
+	})
+
+	t.Run("clientset from the cache is reused", func(t *testing.T) {
+		// given
+		cl := test.NewFakeClient(t, objs...)
+		cache := setupCachedClusters(t, cl, clusters...)
+		probe := &clientsetProbe{clientsets: map[string]kubeclientset.Interface{}}
+
+		// when
+		updateClusterStatuses(context.TODO(), cache, "test-namespace", cl, WithHealthProbes(probe))
+
+		// then
+		require.Len(t, probe.clientsets, 6)
+		for name, clientset := range probe.clientsets {
+			cachedCluster, ok := cache.GetCachedToolchainCluster(name)
+			require.True(t, ok)
+			require.NotNil(t, cachedCluster.Clientset)
+			assert.Same(t, cachedCluster.Clientset, clientset)
+		}
+	})
+}
+
+// concurrencyProbe records the maximum number of probes that were running at the same time
+type concurrencyProbe struct {
+	sync.Mutex
+	running    int
+	maxRunning int
+	calls      int
+}
+
+func (p *concurrencyProbe) Name() string {
+	return "concurrency"
+}
+
+func (p *concurrencyProbe) Probe(_ context.Context, _ *cluster.CachedToolchainCluster, _ kubeclientset.Interface) HealthProbeResult {
+	p.Lock()
+	p.running++
+	p.calls++
+	if p.running > p.maxRunning {
+		p.maxRunning = p.running
+	}
+	p.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	p.Lock()
+	p.running--
+	p.Unlock()
+	return HealthProbeResult{Healthy: true, Message: "healthy"}
+}
+
+// slowProbe doesn't respond for the slow cluster until the deadline is exceeded
+type slowProbe struct {
+	slowCluster string
+}
+
+func (p slowProbe) Name() string {
+	return "slow"
+}
+
+func (p slowProbe) Probe(ctx context.Context, cachedCluster *cluster.CachedToolchainCluster, _ kubeclientset.Interface) HealthProbeResult {
+	if cachedCluster.Name == p.slowCluster {
+		select {
+		case <-ctx.Done():
+			return HealthProbeResult{Unreachable: true, Message: ctx.Err().Error()}
+		case <-time.After(time.Minute):
+		}
+	}
+	return HealthProbeResult{Healthy: true, Message: "healthy"}
+}
+
+// clientsetProbe records the clientsets the probe was called with
+type clientsetProbe struct {
+	sync.Mutex
+	clientsets map[string]kubeclientset.Interface
+}
+
+func (p *clientsetProbe) Name() string {
+	return "clientset"
+}
+
+func (p *clientsetProbe) Probe(_ context.Context, cachedCluster *cluster.CachedToolchainCluster, clientset kubeclientset.Interface) HealthProbeResult {
+	p.Lock()
+	defer p.Unlock()
+	p.clientsets[cachedCluster.Name] = clientset
+	return HealthProbeResult{Healthy: true, Message: "healthy"}
+}
@@ -0,0 +1,106 @@
+package toolchaincluster
+
+import (
+	"sync"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	metricsNamespace = "toolchain"
+	metricsSubsystem = "cluster"
+
+	// unreachableProbeError is the reason of the probe error when the probe couldn't reach the cluster
+	unreachableProbeError = "unreachable"
+	// unhealthyProbeError is the reason of the probe error when the cluster didn't pass the probe
+	unhealthyProbeError = "unhealthy"
+)
+
+var (
+	// readyGauge is 1 when the Ready condition of the cluster is true, 0 otherwise
+	readyGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "ready",
+		Help:      "Whether the cluster is ready (1) or not (0) as of the last health check",
+	}, []string{"cluster_name"})
+
+	// offlineGauge is 1 when the Offline condition of the cluster is true, 0 otherwise
+	offlineGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "offline",
+		Help:      "Whether the cluster is offline (1) or not (0) as of the last health check",
+	}, []string{"cluster_name"})
+
+	// probeDurationHistogram is the duration of the individual health probes
+	probeDurationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "health_probe_duration_seconds",
+		Help:      "Duration of the health probes of the cluster",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"cluster_name", "probe"})
+
+	// probeErrorCounter is the number of the failed health probes by the reason (unreachable or unhealthy)
+	probeErrorCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "health_probe_errors_total",
+		Help:      "Number of the failed health probes of the cluster by the reason",
+	}, []string{"cluster_name", "probe", "reason"})
+
+	// reportedClusters contains the names of the clusters the readiness gauges were set for
+	reportedClusters     = map[string]bool{}
+	reportedClustersLock sync.Mutex
+)
+
+func init() {
+	metrics.Registry.MustRegister(readyGauge, offlineGauge, probeDurationHistogram, probeErrorCounter)
+}
+
+// observeProbe records the duration and the failure (if any) of the probe that started at the given time
+func observeProbe(clusterName, probe string, start time.Time, result HealthProbeResult) {
+	probeDurationHistogram.WithLabelValues(clusterName, probe).Observe(time.Since(start).Seconds())
+	switch {
+	case result.Unreachable:
+		probeErrorCounter.WithLabelValues(clusterName, probe, unreachableProbeError).Inc()
+	case !result.Healthy:
+		probeErrorCounter.WithLabelValues(clusterName, probe, unhealthyProbeError).Inc()
+	}
+}
+
+// setReadinessMetrics sets the ready and offline gauges of the cluster according to the given conditions
+func setReadinessMetrics(clusterName string, conditions []toolchainv1alpha1.ToolchainClusterCondition) {
+	reportedClustersLock.Lock()
+	defer reportedClustersLock.Unlock()
+	readyGauge.WithLabelValues(clusterName).Set(conditionValue(conditions, toolchainv1alpha1.ToolchainClusterReady))
+	offlineGauge.WithLabelValues(clusterName).Set(conditionValue(conditions, toolchainv1alpha1.ToolchainClusterOffline))
+	reportedClusters[clusterName] = true
+}
+
+// deleteReadinessMetricsExcept removes the ready and offline gauges of all clusters except for the given ones
+func deleteReadinessMetricsExcept(clusterNames map[string]bool) {
+	reportedClustersLock.Lock()
+	defer reportedClustersLock.Unlock()
+	for name := range reportedClusters {
+		if !clusterNames[name] {
+			readyGauge.DeleteLabelValues(name)
+			offlineGauge.DeleteLabelValues(name)
+			delete(reportedClusters, name)
+		}
+	}
+}
+
+func conditionValue(conditions []toolchainv1alpha1.ToolchainClusterCondition, conditionType toolchainv1alpha1.ToolchainClusterConditionType) float64 {
+	for _, cond := range conditions {
+		if cond.Type == conditionType && cond.Status == corev1.ConditionTrue {
+			return 1
+		}
+	}
+	return 0
+}
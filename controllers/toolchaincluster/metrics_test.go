@@ -0,0 +1,105 @@
+package toolchaincluster
+
+import (
+	"context"
+	"testing"
+
+	"github.com/codeready-toolchain/toolchain-common/pkg/cluster"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/h2non/gock.v1"
+	kubeclientset "k8s.io/client-go/kubernetes"
+)
+
+func TestHealthCheckMetrics(t *testing.T) {
+	// given
+	defer gock.Off()
+	stable, sec := newToolchainCluster("metrics-stable", "http://cluster.com", withStatus(offline()))
+	unstable, _ := newToolchainCluster("metrics-unstable", "http://unstable.com", withStatus(healthy()))
+	cl := test.NewFakeClient(t, stable, unstable, sec)
+	cache := setupCachedClusters(t, cl, stable, unstable)
+	probe := &switchableProbe{healthy: true}
+	unstableErrors := testutil.ToFloat64(probeErrorCounter.WithLabelValues("metrics-unstable", "fake", unhealthyProbeError))
+	unreachableErrors := testutil.ToFloat64(probeErrorCounter.WithLabelValues("metrics-unstable", "fake", unreachableProbeError))
+
+	t.Run("readiness gauges reflect the status of the clusters", func(t *testing.T) {
+		// when
+		updateClusterStatuses(context.TODO(), cache, "test-namespace", cl, WithHealthProbes(probe, failingFor("metrics-unstable")))
+
+		// then
+		assertReadinessMetrics(t, "metrics-stable", 1, 0)
+		assertReadinessMetrics(t, "metrics-unstable", 0, 0)
+		assert.Equal(t, unstableErrors+1, testutil.ToFloat64(probeErrorCounter.WithLabelValues("metrics-unstable", "fake", unhealthyProbeError)))
+		assert.Equal(t, unreachableErrors, testutil.ToFloat64(probeErrorCounter.WithLabelValues("metrics-unstable", "fake", unreachableProbeError)))
+		assert.Positive(t, testutil.CollectAndCount(probeDurationHistogram))
+	})
+
+	t.Run("unreachable cluster is offline", func(t *testing.T) {
+		// when
+		updateClusterStatuses(context.TODO(), cache, "test-namespace", cl, WithHealthProbes(unreachableFor("metrics-unstable"), probe))
+
+		// then
+		assertReadinessMetrics(t, "metrics-stable", 1, 0)
+		assertReadinessMetrics(t, "metrics-unstable", 0, 1)
+		assert.Equal(t, unreachableErrors+1, testutil.ToFloat64(probeErrorCounter.WithLabelValues("metrics-unstable", "fake", unreachableProbeError)))
+	})
+
+	t.Run("readiness gauges of deleted clusters are removed", func(t *testing.T) {
+		// given
+		require.NoError(t, cl.Delete(context.TODO(), unstable))
+
+		// when
+		updateClusterStatuses(context.TODO(), cache, "test-namespace", cl, WithHealthProbes(probe))
+
+		// then
+		assertReadinessMetrics(t, "metrics-stable", 1, 0)
+		assert.False(t, readyGauge.DeleteLabelValues("metrics-unstable"))
+		assert.False(t, offlineGauge.DeleteLabelValues("metrics-unstable"))
+	})
+
+	t.Run("cluster that is not in the cache is offline", func(t *testing.T) {
+		// given
+		uncached, sec := newToolchainCluster("metrics-uncached", "http://failing.com", withStatus(healthy()))
+		cl := test.NewFakeClient(t, uncached, sec)
+
+		// when
+		updateClusterStatuses(context.TODO(), cluster.NewClusterCache(), "test-namespace", cl, WithHealthProbes(probe))
+
+		// then
+		assertReadinessMetrics(t, "metrics-uncached", 0, 1)
+		assert.False(t, readyGauge.DeleteLabelValues("metrics-stable"))
+	})
+}
+
+func assertReadinessMetrics(t *testing.T, clusterName string, ready, offline float64) {
+	assert.Equal(t, ready, testutil.ToFloat64(readyGauge.WithLabelValues(clusterName)), "ready gauge of %s", clusterName)
+	assert.Equal(t, offline, testutil.ToFloat64(offlineGauge.WithLabelValues(clusterName)), "offline gauge of %s", clusterName)
+}
+
+// failingFor returns a probe that fails for the given cluster and passes for all the other ones
+func failingFor(clusterName string) HealthProbe {
+	return clusterSpecificProbe{clusterName: clusterName, result: HealthProbeResult{Message: "unhealthy"}}
+}
+
+// unreachableFor returns a probe that cannot reach the given cluster and passes for all the other ones
+func unreachableFor(clusterName string) HealthProbe {
+	return clusterSpecificProbe{clusterName: clusterName, result: HealthProbeResult{Unreachable: true, Message: "unreachable"}}
+}
+
+type clusterSpecificProbe struct {
+	clusterName string
+	result      HealthProbeResult
+}
+
+func (p clusterSpecificProbe) Name() string {
+	return "fake"
+}
+
+func (p clusterSpecificProbe) Probe(_ context.Context, cachedCluster *cluster.CachedToolchainCluster, _ kubeclientset.Interface) HealthProbeResult {
+	if cachedCluster.Name == p.clusterName {
+		return p.result
+	}
+	return HealthProbeResult{Healthy: true}
+}
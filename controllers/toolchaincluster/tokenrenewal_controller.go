@@ -0,0 +1,243 @@
+package toolchaincluster
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/toolchain-common/pkg/cluster"
+	"github.com/pkg/errors"
+	authv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubeclientset "k8s.io/client-go/kubernetes"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// DefaultTokenRenewalFraction is the default fraction of the lifetime of the token after which the token is renewed
+	DefaultTokenRenewalFraction = 0.8
+
+	// serviceAccountSubjectPrefix is the prefix of the subject of the ServiceAccount tokens
+	serviceAccountSubjectPrefix = "system:serviceaccount:"
+)
+
+// TokenRenewalOption is an option of the TokenRenewalReconciler
+type TokenRenewalOption func(*TokenRenewalReconciler)
+
+// WithRenewalFraction sets the fraction of the lifetime of the token after which the token is renewed (DefaultTokenRenewalFraction by default).
+// The fraction has to be greater than 0 and lower than 1, otherwise it's ignored.
+func WithRenewalFraction(fraction float64) TokenRenewalOption {
+	return func(r *TokenRenewalReconciler) {
+		if fraction > 0 && fraction < 1 {
+			r.renewalFraction = fraction
+		}
+	}
+}
+
+// WithRenewedTokenExpiration sets the expiration of the renewed tokens. By default, the renewed token has the same lifetime as the current one.
+func WithRenewedTokenExpiration(expiration time.Duration) TokenRenewalOption {
+	return func(r *TokenRenewalReconciler) {
+		r.tokenExpiration = expiration
+	}
+}
+
+// NewTokenRenewalReconciler returns a new TokenRenewalReconciler that renews the tokens of the clusters stored in the given cluster cache
+func NewTokenRenewalReconciler(mgr manager.Manager, cache *cluster.ClusterCache, namespace string, options ...TokenRenewalOption) *TokenRenewalReconciler {
+	r := &TokenRenewalReconciler{
+		client:          mgr.GetClient(),
+		cache:           cache,
+		renewalFraction: DefaultTokenRenewalFraction,
+		namespace:       namespace,
+	}
+	for _, apply := range options {
+		apply(r)
+	}
+	return r
+}
+
+// TokenRenewalReconciler renews the ServiceAccount tokens stored in the Secrets referenced by ToolchainClusters before they expire.
+// The expiration of the token is decoded from the token itself (a JWT) and when the configured fraction of its lifetime passes,
+// a new token is requested for the same ServiceAccount through the cached client of the remote cluster (so the ServiceAccount
+// needs the permission to create tokens for itself). The new token is stored in the Secret - the client of the cluster is then rebuilt
+// by the ToolchainCluster controller that watches the Secret.
+// The tokens without any expiration and the credentials other than tokens are left as they are.
+type TokenRenewalReconciler struct {
+	client          client.Client
+	cache           *cluster.ClusterCache
+	renewalFraction float64
+	tokenExpiration time.Duration
+	namespace       string
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// Besides the ToolchainClusters, it also watches the Secrets referenced by them (in the operator namespace), so the renewal is rescheduled
+// when the token is changed.
+func (r *TokenRenewalReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("toolchaincluster-token-renewal").
+		For(&toolchainv1alpha1.ToolchainCluster{}).
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(MapSecretToToolchainClusters(r.client)),
+			builder.WithPredicates(InNamespace(r.namespace))).
+		Complete(r)
+}
+
+// Reconcile renews the token of the given ToolchainCluster if the renewal time of the token has passed.
+// Otherwise, the request is requeued so it's reconciled again at the renewal time.
+func (r *TokenRenewalReconciler) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.Result, error) {
+	reqLogger := log.FromContext(ctx)
+
+	toolchainCluster := &toolchainv1alpha1.ToolchainCluster{}
+	if err := r.client.Get(ctx, request.NamespacedName, toolchainCluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+	secret := &corev1.Secret{}
+	if err := r.client.Get(ctx, types.NamespacedName{Namespace: toolchainCluster.Namespace, Name: toolchainCluster.Spec.SecretRef.Name}, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			// the missing secret is reported in the ConfigurationValid condition of the ToolchainCluster
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+	token := string(secret.Data[cluster.ToolchainTokenKey])
+	if token == "" {
+		return reconcile.Result{}, nil
+	}
+	claims, err := parseServiceAccountToken(token)
+	if err != nil {
+		reqLogger.Info("the token of the cluster is not renewed", "reason", err.Error())
+		return reconcile.Result{}, nil
+	}
+	if renewIn := r.renewIn(claims); renewIn > 0 {
+		return reconcile.Result{RequeueAfter: renewIn}, nil
+	}
+
+	reqLogger.Info("renewing the token of the cluster", "ServiceAccount.Namespace", claims.namespace, "ServiceAccount.Name", claims.name, "expiry", claims.expiry)
+	newToken, err := r.requestToken(ctx, toolchainCluster.Name, claims)
+	if err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "unable to renew the token of cluster %s", toolchainCluster.Name)
+	}
+	secret.Data[cluster.ToolchainTokenKey] = []byte(newToken)
+	if err := r.client.Update(ctx, secret); err != nil {
+		return reconcile.Result{}, errors.Wrapf(err, "unable to store the renewed token of cluster %s", toolchainCluster.Name)
+	}
+
+	newClaims, err := parseServiceAccountToken(newToken)
+	if err != nil {
+		reqLogger.Info("the renewed token of the cluster won't be renewed", "reason", err.Error())
+		return reconcile.Result{}, nil
+	}
+	return reconcile.Result{RequeueAfter: r.renewIn(newClaims)}, nil
+}
+
+// renewIn returns the duration after which the token with the given claims should be renewed (or a non-positive duration if it should be renewed now)
+func (r *TokenRenewalReconciler) renewIn(claims *serviceAccountTokenClaims) time.Duration {
+	lifetime := claims.expiry.Sub(claims.issuedAt)
+	renewAt := claims.issuedAt.Add(time.Duration(float64(lifetime) * r.renewalFraction))
+	return time.Until(renewAt)
+}
+
+// requestToken requests a new token for the ServiceAccount of the given claims through the cached client of the given cluster
+func (r *TokenRenewalReconciler) requestToken(ctx context.Context, clusterName string, claims *serviceAccountTokenClaims) (string, error) {
+	cachedCluster, ok := r.cache.GetCachedToolchainCluster(clusterName)
+	if !ok {
+		return "", fmt.Errorf("the cluster %s is not in the cache", clusterName)
+	}
+	clientset := cachedCluster.Clientset
+	if clientset == nil {
+		var err error
+		if clientset, err = kubeclientset.NewForConfig(cachedCluster.RestConfig); err != nil {
+			return "", err
+		}
+	}
+	expiration := r.tokenExpiration
+	if expiration <= 0 {
+		expiration = claims.expiry.Sub(claims.issuedAt)
+	}
+	tokenRequest, err := clientset.CoreV1().ServiceAccounts(claims.namespace).CreateToken(ctx, claims.name, &authv1.TokenRequest{
+		Spec: authv1.TokenRequestSpec{
+			ExpirationSeconds: pointer.Int64(int64(expiration.Seconds())),
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return "", err
+	}
+	if tokenRequest.Status.Token == "" {
+		return "", fmt.Errorf("unable to create token, got empty string")
+	}
+	return tokenRequest.Status.Token, nil
+}
+
+// serviceAccountTokenClaims contains the claims of a ServiceAccount token that are needed for its renewal
+type serviceAccountTokenClaims struct {
+	namespace string
+	name      string
+	issuedAt  time.Time
+	expiry    time.Time
+}
+
+// parseServiceAccountToken decodes the claims of the given ServiceAccount token. The signature of the token is not verified,
+// the claims are used only for scheduling the renewal - the token itself is verified by the API server of the remote cluster.
+func parseServiceAccountToken(token string) (*serviceAccountTokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("the token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decode the payload of the token")
+	}
+	rawClaims := struct {
+		Expiry     *int64 `json:"exp"`
+		IssuedAt   *int64 `json:"iat"`
+		Subject    string `json:"sub"`
+		Kubernetes struct {
+			Namespace      string `json:"namespace"`
+			ServiceAccount struct {
+				Name string `json:"name"`
+			} `json:"serviceaccount"`
+		} `json:"kubernetes.io"`
+	}{}
+	if err := json.Unmarshal(payload, &rawClaims); err != nil {
+		return nil, errors.Wrap(err, "unable to unmarshal the claims of the token")
+	}
+	if rawClaims.Expiry == nil || rawClaims.IssuedAt == nil {
+		return nil, fmt.Errorf("the token doesn't expire")
+	}
+	claims := &serviceAccountTokenClaims{
+		namespace: rawClaims.Kubernetes.Namespace,
+		name:      rawClaims.Kubernetes.ServiceAccount.Name,
+		issuedAt:  time.Unix(*rawClaims.IssuedAt, 0),
+		expiry:    time.Unix(*rawClaims.Expiry, 0),
+	}
+	if claims.namespace == "" || claims.name == "" {
+		// the legacy tokens contain the ServiceAccount only in the subject
+		subject := strings.Split(strings.TrimPrefix(rawClaims.Subject, serviceAccountSubjectPrefix), ":")
+		if !strings.HasPrefix(rawClaims.Subject, serviceAccountSubjectPrefix) || len(subject) != 2 {
+			return nil, fmt.Errorf("the token is not a ServiceAccount token")
+		}
+		claims.namespace, claims.name = subject[0], subject[1]
+	}
+	if !claims.expiry.After(claims.issuedAt) {
+		return nil, fmt.Errorf("the token expires before it was issued")
+	}
+	return claims, nil
+}
@@ -0,0 +1,316 @@
+package toolchaincluster
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/codeready-toolchain/toolchain-common/pkg/cluster"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/h2non/gock.v1"
+	authv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestTokenRenewal(t *testing.T) {
+	// given
+	defer gock.Off()
+	now := time.Now()
+
+	t.Run("token is not renewed before the renewal time", func(t *testing.T) {
+		// given
+		token := newServiceAccountToken(t, "toolchain-member-operator", "toolchaincluster-member", now.Add(-time.Hour), now.Add(9*time.Hour))
+		controller, req, cl, requests := prepareTokenRenewal(t, token)
+
+		// when
+		result, err := controller.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		assert.InDelta(t, 7*time.Hour, result.RequeueAfter, float64(time.Minute))
+		assert.Empty(t, *requests)
+		assertToken(t, cl, token)
+	})
+
+	t.Run("token is renewed after the renewal time", func(t *testing.T) {
+		// given
+		token := newServiceAccountToken(t, "toolchain-member-operator", "toolchaincluster-member", now.Add(-9*time.Hour), now.Add(time.Hour))
+		controller, req, cl, requests := prepareTokenRenewal(t, token)
+
+		// when
+		result, err := controller.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, *requests, 1)
+		assert.Equal(t, "toolchain-member-operator", (*requests)[0].namespace)
+		assert.Equal(t, "toolchaincluster-member", (*requests)[0].name)
+		assert.Equal(t, int64(10*time.Hour.Seconds()), *(*requests)[0].expirationSeconds)
+		// the renewed token is issued now and expires in 10 hours
+		assert.InDelta(t, 8*time.Hour, result.RequeueAfter, float64(time.Minute))
+		renewed := (*requests)[0].token
+		assertToken(t, cl, renewed)
+	})
+
+	t.Run("token is renewed with the configured fraction and expiration", func(t *testing.T) {
+		// given
+		token := newServiceAccountToken(t, "toolchain-member-operator", "toolchaincluster-member", now.Add(-6*time.Hour), now.Add(4*time.Hour))
+		controller, req, cl, requests := prepareTokenRenewal(t, token)
+		WithRenewalFraction(0.5)(controller)
+		WithRenewedTokenExpiration(24 * time.Hour)(controller)
+
+		// when
+		result, err := controller.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, *requests, 1)
+		assert.Equal(t, int64(24*time.Hour.Seconds()), *(*requests)[0].expirationSeconds)
+		assert.InDelta(t, 12*time.Hour, result.RequeueAfter, float64(time.Minute))
+		assertToken(t, cl, (*requests)[0].token)
+	})
+
+	t.Run("invalid fraction is ignored", func(t *testing.T) {
+		// given
+		controller := &TokenRenewalReconciler{renewalFraction: DefaultTokenRenewalFraction}
+
+		// when
+		WithRenewalFraction(1.5)(controller)
+		WithRenewalFraction(0)(controller)
+
+		// then
+		assert.Equal(t, DefaultTokenRenewalFraction, controller.renewalFraction)
+	})
+
+	t.Run("token without expiration is not renewed", func(t *testing.T) {
+		// given
+		token := newToken(t, map[string]interface{}{"sub": "system:serviceaccount:toolchain-member-operator:toolchaincluster-member"})
+		controller, req, cl, requests := prepareTokenRenewal(t, token)
+
+		// when
+		result, err := controller.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, reconcile.Result{}, result)
+		assert.Empty(t, *requests)
+		assertToken(t, cl, token)
+	})
+
+	t.Run("token that is not a JWT is not renewed", func(t *testing.T) {
+		// given
+		controller, req, cl, requests := prepareTokenRenewal(t, "mycooltoken")
+
+		// when
+		result, err := controller.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, reconcile.Result{}, result)
+		assert.Empty(t, *requests)
+		assertToken(t, cl, "mycooltoken")
+	})
+
+	t.Run("fails when the cluster is not in the cache", func(t *testing.T) {
+		// given
+		token := newServiceAccountToken(t, "toolchain-member-operator", "toolchaincluster-member", now.Add(-9*time.Hour), now.Add(time.Hour))
+		controller, req, cl, _ := prepareTokenRenewal(t, token)
+		controller.cache = cluster.NewClusterCache()
+
+		// when
+		_, err := controller.Reconcile(context.TODO(), req)
+
+		// then
+		require.EqualError(t, err, "unable to renew the token of cluster member-cluster: the cluster member-cluster is not in the cache")
+		assertToken(t, cl, token)
+	})
+
+	t.Run("fails when the token cannot be created", func(t *testing.T) {
+		// given
+		token := newServiceAccountToken(t, "toolchain-member-operator", "toolchaincluster-member", now.Add(-9*time.Hour), now.Add(time.Hour))
+		controller, req, cl, _ := prepareTokenRenewal(t, token)
+		cachedCluster, _ := controller.cache.GetCachedToolchainCluster("member-cluster")
+		clientset := fake.NewSimpleClientset()
+		clientset.PrependReactor("create", "serviceaccounts", func(action clienttesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("forbidden")
+		})
+		cachedCluster.Clientset = clientset
+
+		// when
+		_, err := controller.Reconcile(context.TODO(), req)
+
+		// then
+		require.EqualError(t, err, "unable to renew the token of cluster member-cluster: forbidden")
+		assertToken(t, cl, token)
+	})
+
+	t.Run("missing ToolchainCluster is ignored", func(t *testing.T) {
+		// given
+		controller, req, _, _ := prepareTokenRenewal(t, "mycooltoken")
+		req.Name = "unknown"
+
+		// when
+		result, err := controller.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, reconcile.Result{}, result)
+	})
+}
+
+func TestParseServiceAccountToken(t *testing.T) {
+	issuedAt := time.Unix(1700000000, 0)
+	expiry := issuedAt.Add(time.Hour)
+
+	t.Run("bound token", func(t *testing.T) {
+		// when
+		claims, err := parseServiceAccountToken(newServiceAccountToken(t, "ns", "sa", issuedAt, expiry))
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, &serviceAccountTokenClaims{namespace: "ns", name: "sa", issuedAt: issuedAt, expiry: expiry}, claims)
+	})
+
+	t.Run("token with the ServiceAccount in the subject only", func(t *testing.T) {
+		// when
+		claims, err := parseServiceAccountToken(newToken(t, map[string]interface{}{
+			"sub": "system:serviceaccount:ns:sa",
+			"iat": issuedAt.Unix(),
+			"exp": expiry.Unix(),
+		}))
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, &serviceAccountTokenClaims{namespace: "ns", name: "sa", issuedAt: issuedAt, expiry: expiry}, claims)
+	})
+
+	t.Run("invalid tokens", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			token       string
+			expectedErr string
+		}{
+			"not a JWT": {
+				token:       "mycooltoken",
+				expectedErr: "the token is not a JWT",
+			},
+			"invalid payload": {
+				token:       "header.%%%.signature",
+				expectedErr: "unable to decode the payload of the token",
+			},
+			"no expiration": {
+				token:       newToken(t, map[string]interface{}{"sub": "system:serviceaccount:ns:sa"}),
+				expectedErr: "the token doesn't expire",
+			},
+			"not a ServiceAccount": {
+				token:       newToken(t, map[string]interface{}{"sub": "john", "iat": issuedAt.Unix(), "exp": expiry.Unix()}),
+				expectedErr: "the token is not a ServiceAccount token",
+			},
+			"expires before it was issued": {
+				token:       newServiceAccountToken(t, "ns", "sa", expiry, issuedAt),
+				expectedErr: "the token expires before it was issued",
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				// when
+				_, err := parseServiceAccountToken(tc.token)
+
+				// then
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+			})
+		}
+	})
+}
+
+// tokenRequest is a TokenRequest received by the fake clientset of the remote cluster
+type tokenRequest struct {
+	namespace         string
+	name              string
+	expirationSeconds *int64
+	token             string
+}
+
+func prepareTokenRenewal(t *testing.T, token string) (*TokenRenewalReconciler, reconcile.Request, *test.FakeClient, *[]tokenRequest) {
+	toolchainCluster, secret := newToolchainCluster("member-cluster", "http://cluster.com", withStatus())
+	secret.Data["token"] = []byte(token)
+	cl := test.NewFakeClient(t, toolchainCluster, secret)
+	cache := cluster.NewClusterCache()
+	service := cluster.NewToolchainClusterServiceWithCache(cache, cl, logf.Log, "test-namespace", 0, func(config *rest.Config, options client.Options) (client.Client, error) {
+		// make sure that insecure is false to make Gock mocking working properly
+		config.Insecure = false
+		return client.New(config, options)
+	})
+	require.NoError(t, service.AddOrUpdateToolchainCluster(toolchainCluster))
+	cachedCluster, ok := cache.GetCachedToolchainCluster(toolchainCluster.Name)
+	require.True(t, ok)
+
+	requests := &[]tokenRequest{}
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "serviceaccounts", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		createAction := action.(clienttesting.CreateActionImpl)
+		require.Equal(t, "token", createAction.GetSubresource())
+		request := createAction.GetObject().(*authv1.TokenRequest)
+		issuedAt := time.Now()
+		renewed := newServiceAccountToken(t, action.GetNamespace(), createAction.Name, issuedAt,
+			issuedAt.Add(time.Duration(*request.Spec.ExpirationSeconds)*time.Second))
+		*requests = append(*requests, tokenRequest{
+			namespace:         action.GetNamespace(),
+			name:              createAction.Name,
+			expirationSeconds: request.Spec.ExpirationSeconds,
+			token:             renewed,
+		})
+		request.Status.Token = renewed
+		return true, request, nil
+	})
+	cachedCluster.Clientset = clientset
+
+	controller := &TokenRenewalReconciler{
+		client:          cl,
+		cache:           cache,
+		renewalFraction: DefaultTokenRenewalFraction,
+	}
+	req := reconcile.Request{
+		NamespacedName: test.NamespacedName(toolchainCluster.Namespace, toolchainCluster.Name),
+	}
+	return controller, req, cl, requests
+}
+
+func assertToken(t *testing.T, cl client.Client, expected string) {
+	secret := &corev1.Secret{}
+	require.NoError(t, cl.Get(context.TODO(), test.NamespacedName("test-namespace", "secret"), secret))
+	assert.Equal(t, expected, string(secret.Data["token"]))
+}
+
+func newServiceAccountToken(t *testing.T, namespace, name string, issuedAt, expiry time.Time) string {
+	return newToken(t, map[string]interface{}{
+		"sub": fmt.Sprintf("system:serviceaccount:%s:%s", namespace, name),
+		"iat": issuedAt.Unix(),
+		"exp": expiry.Unix(),
+		"kubernetes.io": map[string]interface{}{
+			"namespace": namespace,
+			"serviceaccount": map[string]interface{}{
+				"name": name,
+			},
+		},
+	})
+}
+
+// newToken returns an unsigned JWT with the given claims
+func newToken(t *testing.T, claims map[string]interface{}) string {
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	return fmt.Sprintf("%s.%s.signature", header, base64.RawURLEncoding.EncodeToString(payload))
+}
@@ -6,38 +6,107 @@ import (
 
 	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
 	"github.com/codeready-toolchain/toolchain-common/pkg/cluster"
-	"k8s.io/apimachinery/pkg/api/errors"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
-// NewReconciler returns a new Reconciler
+const (
+	// ToolchainClusterConfigurationValid is the type of the condition reporting whether the ToolchainCluster passed the validation
+	ToolchainClusterConfigurationValid toolchainv1alpha1.ToolchainClusterConditionType = "ConfigurationValid"
+	// ToolchainClusterConfigurationValidReason is the reason of the ConfigurationValid condition when the ToolchainCluster is valid
+	ToolchainClusterConfigurationValidReason = "ConfigurationValid"
+	// ToolchainClusterConfigurationInvalidReason is the reason of the ConfigurationValid condition when the ToolchainCluster is not valid.
+	// When the client of the cluster cannot be constructed, then the reason of the failure is used instead (eg. cluster.InvalidCABundleReason).
+	ToolchainClusterConfigurationInvalidReason = "ConfigurationInvalid"
+
+	configurationValidMsg = "the configuration of the cluster is valid"
+)
+
+// NewReconciler returns a new Reconciler that stores the clusters in the default cluster cache
 func NewReconciler(mgr manager.Manager, namespace string, timeout time.Duration) *Reconciler {
+	return NewReconcilerWithCache(mgr, cluster.DefaultClusterCache(), namespace, timeout)
+}
+
+// NewReconcilerWithCache returns a new Reconciler that stores the clusters in the given cluster cache
+func NewReconcilerWithCache(mgr manager.Manager, cache *cluster.ClusterCache, namespace string, timeout time.Duration, options ...cluster.ServiceOption) *Reconciler {
 	cacheLog := log.Log.WithName("toolchaincluster_cache")
-	clusterCacheService := cluster.NewToolchainClusterService(mgr.GetClient(), cacheLog, namespace, timeout)
+	clusterCacheService := cluster.NewToolchainClusterServiceWithCache(cache, mgr.GetClient(), cacheLog, namespace, timeout, nil, options...)
 	return &Reconciler{
 		client:              mgr.GetClient(),
 		scheme:              mgr.GetScheme(),
+		recorder:            mgr.GetEventRecorderFor("toolchaincluster-controller"),
 		clusterCacheService: clusterCacheService,
+		namespace:           namespace,
 	}
 }
 
 // SetupWithManager sets up the controller with the Manager.
+// Besides the ToolchainClusters, it also watches the Secrets referenced by them (in the operator namespace), so the clients
+// of the clusters are rebuilt when the credentials are rotated.
 func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&toolchainv1alpha1.ToolchainCluster{}).
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(MapSecretToToolchainClusters(r.client)),
+			builder.WithPredicates(InNamespace(r.namespace))).
 		Complete(r)
 }
 
+// InNamespace returns a predicate that filters only the objects in the given namespace, so the Secrets outside of the namespace
+// of the ToolchainClusters are not mapped to the ToolchainClusters at all.
+func InNamespace(namespace string) predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return obj.GetNamespace() == namespace
+	})
+}
+
+// MapSecretToToolchainClusters returns a function that maps a Secret to the requests of all ToolchainClusters
+// (in the same namespace) that reference the Secret in their spec.
+func MapSecretToToolchainClusters(cl client.Client) handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		logger := log.Log.WithName("toolchaincluster_secret_mapper").WithValues("Secret.Namespace", obj.GetNamespace(), "Secret.Name", obj.GetName())
+		toolchainClusters := &toolchainv1alpha1.ToolchainClusterList{}
+		if err := cl.List(context.TODO(), toolchainClusters, client.InNamespace(obj.GetNamespace())); err != nil {
+			logger.Error(err, "unable to list ToolchainClusters referencing the Secret")
+			return []reconcile.Request{}
+		}
+		requests := []reconcile.Request{}
+		for _, toolchainCluster := range toolchainClusters.Items {
+			if toolchainCluster.Spec.SecretRef.Name == obj.GetName() {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{
+						Namespace: toolchainCluster.Namespace,
+						Name:      toolchainCluster.Name,
+					},
+				})
+			}
+		}
+		return requests
+	}
+}
+
 // Reconciler reconciles a ToolchainCluster object
 type Reconciler struct {
 	client              client.Client
 	scheme              *runtime.Scheme
+	recorder            record.EventRecorder
 	clusterCacheService cluster.ToolchainClusterService
+	namespace           string
 }
 
 // Reconcile reads that state of the cluster for a ToolchainCluster object and makes changes based on the state read
@@ -53,7 +122,7 @@ func (r *Reconciler) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.
 	toolchainCluster := &toolchainv1alpha1.ToolchainCluster{}
 	err := r.client.Get(ctx, request.NamespacedName, toolchainCluster)
 	if err != nil {
-		if errors.IsNotFound(err) {
+		if apierrors.IsNotFound(err) {
 			r.clusterCacheService.DeleteToolchainCluster(request.Name)
 			return reconcile.Result{}, nil
 		}
@@ -67,7 +136,48 @@ func (r *Reconciler) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.
 		return reconcile.Result{}, err
 	}
 
-	return reconcile.Result{}, r.clusterCacheService.AddOrUpdateToolchainCluster(toolchainCluster)
+	addErr := r.clusterCacheService.AddOrUpdateToolchainCluster(toolchainCluster)
+	if err := r.updateConfigurationValidCondition(ctx, toolchainCluster, addErr); err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{}, addErr
+}
+
+// updateConfigurationValidCondition stores the result of the validation of the given ToolchainCluster in the ConfigurationValid condition.
+// If the client of the cluster couldn't be constructed because of its configuration (the given addErr), then the reason of the failure
+// is used in the condition. The status is updated (and an event is recorded) only when the condition changes.
+// The errors that are not caused by the configuration (eg. a temporary failure when reading the Secret) don't change the condition,
+// the errors of the validation are returned instead.
+func (r *Reconciler) updateConfigurationValidCondition(ctx context.Context, toolchainCluster *toolchainv1alpha1.ToolchainCluster, addErr error) error {
+	condition := configurationValidCondition()
+	if addErr != nil {
+		reason := cluster.ConfigurationErrorReason(addErr)
+		if reason == "" {
+			// the addErr itself is returned by the reconciler
+			return nil
+		}
+		condition = configurationInvalidCondition(reason, addErr.Error())
+	} else if errs := cluster.ValidateToolchainCluster(ctx, r.client, toolchainCluster); len(errs) > 0 {
+		invalid := errs.Filter(field.NewErrorTypeMatcher(field.ErrorTypeInternal))
+		if len(invalid) == 0 {
+			return errors.Wrapf(errs.ToAggregate(), "failed to validate the configuration of cluster %s", toolchainCluster.Name)
+		}
+		condition = configurationInvalidCondition(ToolchainClusterConfigurationInvalidReason, invalid.ToAggregate().Error())
+	}
+	conditions, updated := setCondition(toolchainCluster.Status.Conditions, condition)
+	if !updated {
+		return nil
+	}
+	toolchainCluster.Status.Conditions = conditions
+	if err := r.client.Status().Update(ctx, toolchainCluster); err != nil {
+		return errors.Wrapf(err, "failed to update the %s condition of cluster %s", ToolchainClusterConfigurationValid, toolchainCluster.Name)
+	}
+	if condition.Status == corev1.ConditionTrue {
+		r.recorder.Event(toolchainCluster, corev1.EventTypeNormal, condition.Reason, configurationValidMsg)
+	} else {
+		r.recorder.Event(toolchainCluster, corev1.EventTypeWarning, condition.Reason, condition.Message)
+	}
+	return nil
 }
 
 func (r *Reconciler) addToolchainClusterRoleLabelFromType(ctx context.Context, toolchainCluster *toolchainv1alpha1.ToolchainCluster) error {
@@ -91,3 +201,46 @@ func (r *Reconciler) addToolchainClusterRoleLabelFromType(ctx context.Context, t
 	}
 	return nil
 }
+
+func configurationValidCondition() toolchainv1alpha1.ToolchainClusterCondition {
+	currentTime := metav1.Now()
+	return toolchainv1alpha1.ToolchainClusterCondition{
+		Type:               ToolchainClusterConfigurationValid,
+		Status:             corev1.ConditionTrue,
+		Reason:             ToolchainClusterConfigurationValidReason,
+		Message:            configurationValidMsg,
+		LastProbeTime:      currentTime,
+		LastTransitionTime: &currentTime,
+	}
+}
+
+func configurationInvalidCondition(reason, message string) toolchainv1alpha1.ToolchainClusterCondition {
+	currentTime := metav1.Now()
+	return toolchainv1alpha1.ToolchainClusterCondition{
+		Type:               ToolchainClusterConfigurationValid,
+		Status:             corev1.ConditionFalse,
+		Reason:             reason,
+		Message:            message,
+		LastProbeTime:      currentTime,
+		LastTransitionTime: &currentTime,
+	}
+}
+
+// setCondition sets the given condition in the list of conditions replacing the existing one of the same type.
+// The transition time is kept when the status doesn't change. Returns the new list of conditions and info if anything
+// except for the probe time has changed.
+func setCondition(conditions []toolchainv1alpha1.ToolchainClusterCondition, condition toolchainv1alpha1.ToolchainClusterCondition) ([]toolchainv1alpha1.ToolchainClusterCondition, bool) {
+	newConditions := make([]toolchainv1alpha1.ToolchainClusterCondition, 0, len(conditions)+1)
+	updated := true
+	for _, existing := range conditions {
+		if existing.Type != condition.Type {
+			newConditions = append(newConditions, existing)
+			continue
+		}
+		if existing.Status == condition.Status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+			updated = existing.Reason != condition.Reason || existing.Message != condition.Message
+		}
+	}
+	return append(newConditions, condition), updated
+}
@@ -2,13 +2,24 @@ package toolchaincluster
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
 	"github.com/codeready-toolchain/toolchain-common/pkg/cluster"
 	"github.com/codeready-toolchain/toolchain-common/pkg/test"
 	"github.com/codeready-toolchain/toolchain-common/pkg/test/verify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/h2non/gock.v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
@@ -87,10 +98,341 @@ func TestDeleteToolchainCluster(t *testing.T) {
 	})
 }
 
+func TestMapSecretToToolchainClusters(t *testing.T) {
+	// given
+	status := test.NewClusterStatus(toolchainv1alpha1.ToolchainClusterReady, corev1.ConditionTrue)
+	east, eastSecret := test.NewToolchainCluster("east", "secret-east", status, verify.Labels(cluster.Member, "", test.NameHost))
+	west, _ := test.NewToolchainCluster("west", "secret-east", status, verify.Labels(cluster.Member, "", test.NameHost))
+	north, northSecret := test.NewToolchainCluster("north", "secret-north", status, verify.Labels(cluster.Member, "", test.NameHost))
+	_, unusedSecret := test.NewToolchainCluster("south", "secret-unused", status, verify.Labels(cluster.Member, "", test.NameHost))
+
+	t.Run("maps to all clusters referencing the secret", func(t *testing.T) {
+		// given
+		cl := test.NewFakeClient(t, east, west, north)
+
+		// when
+		requests := MapSecretToToolchainClusters(cl)(eastSecret)
+
+		// then
+		assert.ElementsMatch(t, []reconcile.Request{
+			{NamespacedName: test.NamespacedName("test-namespace", "east")},
+			{NamespacedName: test.NamespacedName("test-namespace", "west")},
+		}, requests)
+
+		// when
+		requests = MapSecretToToolchainClusters(cl)(northSecret)
+
+		// then
+		assert.Equal(t, []reconcile.Request{{NamespacedName: test.NamespacedName("test-namespace", "north")}}, requests)
+	})
+
+	t.Run("no cluster referencing the secret", func(t *testing.T) {
+		// given
+		cl := test.NewFakeClient(t, east, west, north)
+
+		// when
+		requests := MapSecretToToolchainClusters(cl)(unusedSecret)
+
+		// then
+		assert.Empty(t, requests)
+	})
+
+	t.Run("list fails", func(t *testing.T) {
+		// given
+		cl := test.NewFakeClient(t, east, west, north)
+		cl.MockList = func(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+			return fmt.Errorf("some error")
+		}
+
+		// when
+		requests := MapSecretToToolchainClusters(cl)(eastSecret)
+
+		// then
+		assert.Empty(t, requests)
+	})
+}
+
+func TestInNamespace(t *testing.T) {
+	// given
+	inNamespace := InNamespace("test-namespace")
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "test-namespace"}}
+	otherSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "other-namespace"}}
+
+	// when & then
+	assert.True(t, inNamespace.Create(event.CreateEvent{Object: secret}))
+	assert.True(t, inNamespace.Update(event.UpdateEvent{ObjectOld: secret, ObjectNew: secret}))
+	assert.False(t, inNamespace.Create(event.CreateEvent{Object: otherSecret}))
+	assert.False(t, inNamespace.Update(event.UpdateEvent{ObjectOld: otherSecret, ObjectNew: otherSecret}))
+	assert.False(t, inNamespace.Delete(event.DeleteEvent{Object: otherSecret}))
+}
+
+func TestReconcileRebuildsClientWhenTokenIsRotated(t *testing.T) {
+	// given
+	defer gock.Off()
+	status := test.NewClusterStatus(toolchainv1alpha1.ToolchainClusterReady, corev1.ConditionTrue)
+	east, eastSecret := test.NewToolchainCluster("east", "secret-east", status, verify.Labels(cluster.Host, "", test.NameMember))
+	cl := test.NewFakeClient(t, east, eastSecret)
+	cache := cluster.NewClusterCache()
+	service := cluster.NewToolchainClusterServiceWithCache(cache, cl, logf.Log, "test-namespace", 0, func(config *rest.Config, options client.Options) (client.Client, error) {
+		return test.NewFakeClient(t), nil
+	})
+	controller, req := prepareReconcile(east, cl, service)
+	_, err := controller.Reconcile(context.TODO(), req)
+	require.NoError(t, err)
+	original, ok := cache.GetCachedToolchainCluster("east")
+	require.True(t, ok)
+
+	eastSecret.Data["token"] = []byte("rotated-token")
+	require.NoError(t, cl.Update(context.TODO(), eastSecret))
+
+	// when
+	requests := MapSecretToToolchainClusters(cl)(eastSecret)
+	require.Len(t, requests, 1)
+	_, err = controller.Reconcile(context.TODO(), requests[0])
+
+	// then
+	require.NoError(t, err)
+	rebuilt, ok := cache.GetCachedToolchainCluster("east")
+	require.True(t, ok)
+	assert.Equal(t, "rotated-token", rebuilt.RestConfig.BearerToken)
+	assert.NotSame(t, original.Client, rebuilt.Client)
+}
+
+func TestReconcileSetsConfigurationValidCondition(t *testing.T) {
+	// given
+	defer gock.Off()
+	status := test.NewClusterStatus(toolchainv1alpha1.ToolchainClusterReady, corev1.ConditionTrue)
+	newService := func(cl client.Client) cluster.ToolchainClusterService {
+		return cluster.NewToolchainClusterServiceWithCache(cluster.NewClusterCache(), cl, logf.Log, "test-namespace", 0, func(config *rest.Config, options client.Options) (client.Client, error) {
+			return test.NewFakeClient(t), nil
+		})
+	}
+
+	t.Run("valid cluster", func(t *testing.T) {
+		// given
+		east, eastSecret := test.NewToolchainCluster("east", "secret-east", status, verify.Labels(cluster.Host, "", test.NameMember))
+		cl := test.NewFakeClient(t, east, eastSecret)
+		controller, req := prepareReconcile(east, cl, newService(cl))
+
+		// when
+		_, err := controller.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		condition := getCondition(t, cl, ToolchainClusterConfigurationValid)
+		assert.Equal(t, corev1.ConditionTrue, condition.Status)
+		assert.Equal(t, ToolchainClusterConfigurationValidReason, condition.Reason)
+		assert.Equal(t, corev1.ConditionTrue, getCondition(t, cl, toolchainv1alpha1.ToolchainClusterReady).Status)
+		assertEvents(t, controller, "Normal ConfigurationValid the configuration of the cluster is valid")
+
+		t.Run("status is not updated when the condition doesn't change", func(t *testing.T) {
+			// given
+			cl.MockStatusUpdate = func(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+				return fmt.Errorf("the status should not be updated")
+			}
+
+			// when
+			_, err := controller.Reconcile(context.TODO(), req)
+
+			// then
+			require.NoError(t, err)
+		})
+	})
+
+	t.Run("invalid cluster", func(t *testing.T) {
+		// given
+		east, eastSecret := test.NewToolchainCluster("east", "secret-east", status, verify.Labels(cluster.Host, "", "not_a_cluster_name"))
+		east.Spec.DisabledTLSValidations = []toolchainv1alpha1.TLSValidation{"Unknown"}
+		cl := test.NewFakeClient(t, east, eastSecret)
+		controller, req := prepareReconcile(east, cl, newService(cl))
+
+		// when
+		_, err := controller.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		condition := getCondition(t, cl, ToolchainClusterConfigurationValid)
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+		assert.Equal(t, ToolchainClusterConfigurationInvalidReason, condition.Reason)
+		assert.Contains(t, condition.Message, "metadata.labels[ownerClusterName]: Invalid value")
+		assert.Contains(t, condition.Message, "spec.disabledTLSValidations[0]: Unsupported value")
+		assertEvents(t, controller, "Warning ConfigurationInvalid "+condition.Message)
+	})
+
+	t.Run("invalid client settings", func(t *testing.T) {
+		// given
+		east, eastSecret := test.NewToolchainCluster("east", "secret-east", status, verify.Labels(cluster.Host, "", test.NameMember))
+		east.Annotations = map[string]string{cluster.BurstAnnotationKey: "many"}
+		cl := test.NewFakeClient(t, east, eastSecret)
+		cache := cluster.NewClusterCache()
+		service := cluster.NewToolchainClusterServiceWithCache(cache, cl, logf.Log, "test-namespace", 0, func(config *rest.Config, options client.Options) (client.Client, error) {
+			return test.NewFakeClient(t), nil
+		})
+		controller, req := prepareReconcile(east, cl, service)
+
+		// when
+		_, err := controller.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		condition := getCondition(t, cl, ToolchainClusterConfigurationValid)
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+		assert.Equal(t, ToolchainClusterConfigurationInvalidReason, condition.Reason)
+		assert.Contains(t, condition.Message, "metadata.annotations[toolchain.dev.openshift.com/api-burst]: Invalid value")
+		assertEvents(t, controller, "Warning ConfigurationInvalid "+condition.Message)
+		// the cluster is kept in the cache with the default settings
+		cachedEast, ok := cache.GetCachedToolchainCluster("east")
+		require.True(t, ok)
+		assert.Equal(t, cluster.DefaultClientSettings(0).Burst, cachedEast.ClientSettings.Burst)
+	})
+
+	t.Run("client construction fails", func(t *testing.T) {
+		for reason, modify := range map[string]func(*toolchainv1alpha1.ToolchainCluster, *corev1.Secret){
+			cluster.InvalidAPIEndpointReason: func(toolchainCluster *toolchainv1alpha1.ToolchainCluster, _ *corev1.Secret) {
+				toolchainCluster.Spec.APIEndpoint = ""
+			},
+			cluster.SecretNotFoundReason: func(toolchainCluster *toolchainv1alpha1.ToolchainCluster, _ *corev1.Secret) {
+				toolchainCluster.Spec.SecretRef.Name = "unknown"
+			},
+			cluster.InvalidCredentialsReason: func(_ *toolchainv1alpha1.ToolchainCluster, secret *corev1.Secret) {
+				secret.Data = map[string][]byte{}
+			},
+			cluster.InvalidCABundleReason: func(toolchainCluster *toolchainv1alpha1.ToolchainCluster, _ *corev1.Secret) {
+				toolchainCluster.Spec.CABundle = "not-base64"
+			},
+		} {
+			t.Run(reason, func(t *testing.T) {
+				// given
+				east, eastSecret := test.NewToolchainCluster("east", "secret-east", status, verify.Labels(cluster.Host, "", test.NameMember))
+				modify(east, eastSecret)
+				cl := test.NewFakeClient(t, east, eastSecret)
+				controller, req := prepareReconcile(east, cl, newService(cl))
+
+				// when
+				_, err := controller.Reconcile(context.TODO(), req)
+
+				// then
+				require.Error(t, err)
+				condition := getCondition(t, cl, ToolchainClusterConfigurationValid)
+				assert.Equal(t, corev1.ConditionFalse, condition.Status)
+				assert.Equal(t, reason, condition.Reason)
+				assert.Equal(t, err.Error(), condition.Message)
+				assertEvents(t, controller, "Warning "+reason+" "+err.Error())
+
+				t.Run("event is not recorded again when the condition doesn't change", func(t *testing.T) {
+					// when
+					_, err := controller.Reconcile(context.TODO(), req)
+
+					// then
+					require.Error(t, err)
+					assertEvents(t, controller)
+				})
+			})
+		}
+
+		t.Run(cluster.ClientCreationFailedReason, func(t *testing.T) {
+			// given
+			east, eastSecret := test.NewToolchainCluster("east", "secret-east", status, verify.Labels(cluster.Host, "", test.NameMember))
+			cl := test.NewFakeClient(t, east, eastSecret)
+			service := cluster.NewToolchainClusterServiceWithCache(cluster.NewClusterCache(), cl, logf.Log, "test-namespace", 0, func(config *rest.Config, options client.Options) (client.Client, error) {
+				return nil, fmt.Errorf("some error")
+			})
+			controller, req := prepareReconcile(east, cl, service)
+
+			// when
+			_, err := controller.Reconcile(context.TODO(), req)
+
+			// then
+			require.EqualError(t, err, "the cluster was not added nor updated: cannot create ToolchainCluster client: some error")
+			condition := getCondition(t, cl, ToolchainClusterConfigurationValid)
+			assert.Equal(t, cluster.ClientCreationFailedReason, condition.Reason)
+			assert.Equal(t, err.Error(), condition.Message)
+		})
+	})
+
+	t.Run("condition is not changed when secret cannot be read", func(t *testing.T) {
+		for name, failingRead := range map[string]int{
+			"when adding the cluster":     1,
+			"when validating the cluster": 2,
+		} {
+			t.Run(name, func(t *testing.T) {
+				// given
+				east, eastSecret := test.NewToolchainCluster("east", "secret-east", status, verify.Labels(cluster.Host, "", test.NameMember))
+				cl := test.NewFakeClient(t, east, eastSecret)
+				controller, req := prepareReconcile(east, cl, newService(cl))
+				_, err := controller.Reconcile(context.TODO(), req)
+				require.NoError(t, err)
+				assertEvents(t, controller, "Normal ConfigurationValid the configuration of the cluster is valid")
+				// the secret is read first when adding the cluster and then when validating it
+				secretReads := 0
+				cl.MockGet = func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					if _, ok := obj.(*corev1.Secret); ok {
+						secretReads++
+						if secretReads == failingRead {
+							return fmt.Errorf("some error")
+						}
+					}
+					return cl.Client.Get(ctx, key, obj, opts...)
+				}
+
+				// when
+				_, err = controller.Reconcile(context.TODO(), req)
+
+				// then
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "some error")
+				condition := getCondition(t, cl, ToolchainClusterConfigurationValid)
+				assert.Equal(t, corev1.ConditionTrue, condition.Status)
+				assert.Equal(t, ToolchainClusterConfigurationValidReason, condition.Reason)
+				assertEvents(t, controller)
+			})
+		}
+	})
+
+	t.Run("status update fails", func(t *testing.T) {
+		// given
+		east, eastSecret := test.NewToolchainCluster("east", "secret-east", status, verify.Labels(cluster.Host, "", test.NameMember))
+		cl := test.NewFakeClient(t, east, eastSecret)
+		cl.MockStatusUpdate = func(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+			return fmt.Errorf("some error")
+		}
+		controller, req := prepareReconcile(east, cl, newService(cl))
+
+		// when
+		_, err := controller.Reconcile(context.TODO(), req)
+
+		// then
+		require.EqualError(t, err, "failed to update the ConfigurationValid condition of cluster east: some error")
+	})
+}
+
+func assertEvents(t *testing.T, controller Reconciler, expected ...string) {
+	recorder, ok := controller.recorder.(*record.FakeRecorder)
+	require.True(t, ok)
+	var actual []string
+	for len(recorder.Events) > 0 {
+		actual = append(actual, <-recorder.Events)
+	}
+	assert.Equal(t, expected, actual)
+}
+
+func getCondition(t *testing.T, cl client.Client, conditionType toolchainv1alpha1.ToolchainClusterConditionType) toolchainv1alpha1.ToolchainClusterCondition {
+	toolchainCluster := &toolchainv1alpha1.ToolchainCluster{}
+	require.NoError(t, cl.Get(context.TODO(), test.NamespacedName("test-namespace", "east"), toolchainCluster))
+	for _, condition := range toolchainCluster.Status.Conditions {
+		if condition.Type == conditionType {
+			return condition
+		}
+	}
+	require.Failf(t, "condition not found", "the condition %s was not found in %v", conditionType, toolchainCluster.Status.Conditions)
+	return toolchainv1alpha1.ToolchainClusterCondition{}
+}
+
 func prepareReconcile(toolchainCluster *toolchainv1alpha1.ToolchainCluster, cl *test.FakeClient, service cluster.ToolchainClusterService) (Reconciler, reconcile.Request) {
 	controller := Reconciler{
 		client:              cl,
 		scheme:              scheme.Scheme,
+		recorder:            record.NewFakeRecorder(10),
 		clusterCacheService: service,
 	}
 	req := reconcile.Request{
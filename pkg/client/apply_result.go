@@ -0,0 +1,171 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// ApplyAction is the action performed (or that would be performed in dry-run) when an object is applied
+type ApplyAction string
+
+const (
+	// CreateAction means that the object was missing and it was created
+	CreateAction ApplyAction = "create"
+	// UpdateAction means that the existing object was updated
+	UpdateAction ApplyAction = "update"
+	// NoopAction means that the existing object was left as it was
+	NoopAction ApplyAction = "noop"
+)
+
+// ApplyResult is the result of applying an object
+type ApplyResult struct {
+	// Object is the applied object
+	Object client.Object
+	// Action is the action that was performed (or that would be performed in dry-run)
+	Action ApplyAction
+	// Diff is the unified diff between the existing (live) object and the desired object. It's set only in dry-run.
+	Diff string
+}
+
+func (r *ApplyResult) changed() bool {
+	return r != nil && r.Action != NoopAction
+}
+
+// ApplyResults are the results of applying multiple objects
+type ApplyResults []ApplyResult
+
+// Changed returns `true` if at least one of the objects was created or updated (or would be in dry-run)
+func (r ApplyResults) Changed() bool {
+	for i := range r {
+		if r[i].changed() {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff returns the diffs of all objects that were created or updated (or would be in dry-run)
+func (r ApplyResults) Diff() string {
+	diff := ""
+	for i := range r {
+		diff += r[i].Diff
+	}
+	return diff
+}
+
+func newApplyResult(config applyObjectConfiguration, action ApplyAction, obj, live client.Object) *ApplyResult {
+	result := &ApplyResult{
+		Object: obj,
+		Action: action,
+	}
+	if config.dryRun && action != NoopAction {
+		result.Diff = diff(live, obj)
+		// eg. when only the annotation with the last applied configuration would change
+		if result.Diff == "" {
+			result.Action = NoopAction
+		}
+	}
+	return result
+}
+
+func noopResult(obj client.Object) *ApplyResult {
+	return &ApplyResult{
+		Object: obj,
+		Action: NoopAction,
+	}
+}
+
+func (c applyObjectConfiguration) createOptions() []client.CreateOption {
+	if c.dryRun {
+		return []client.CreateOption{client.DryRunAll}
+	}
+	return nil
+}
+
+func (c applyObjectConfiguration) updateOptions() []client.UpdateOption {
+	if c.dryRun {
+		return []client.UpdateOption{client.DryRunAll}
+	}
+	return nil
+}
+
+func (c applyObjectConfiguration) patchOptions() []client.PatchOption {
+	if c.dryRun {
+		return []client.PatchOption{client.DryRunAll}
+	}
+	return nil
+}
+
+// diff returns the unified diff between the YAML representations of the live and the desired object
+// (without the status and the metadata set by the server). The live object is `nil` if it doesn't exist.
+func diff(live, desired client.Object) string {
+	liveYAML, err := diffableContent(live)
+	if err != nil {
+		log.Error(err, "unable to marshal the object", "object", live)
+	}
+	desiredYAML, err := diffableContent(desired)
+	if err != nil {
+		log.Error(err, "unable to marshal the object", "object", desired)
+	}
+	name := client.ObjectKeyFromObject(desired).String()
+	if kind := desired.GetObjectKind().GroupVersionKind().Kind; kind != "" {
+		name = fmt.Sprintf("%s %s", kind, name)
+	}
+	fromFile := "live " + name
+	if live == nil {
+		fromFile = "/dev/null"
+	}
+	unifiedDiff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        lines(liveYAML),
+		B:        lines(desiredYAML),
+		FromFile: fromFile,
+		ToFile:   "desired " + name,
+		Context:  3,
+	})
+	if err != nil {
+		log.Error(err, "unable to compute the diff of the object", "object", desired)
+	}
+	return unifiedDiff
+}
+
+func lines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return difflib.SplitLines(strings.TrimSuffix(content, "\n"))
+}
+
+func diffableContent(obj client.Object) (string, error) {
+	if obj == nil {
+		return "", nil
+	}
+	content, err := marshalObjectContent(obj)
+	if err != nil {
+		return "", err
+	}
+	patchable, err := patchableContent(content)
+	if err != nil {
+		return "", err
+	}
+	object := map[string]interface{}{}
+	if err := yaml.Unmarshal(patchable, &object); err != nil {
+		return "", err
+	}
+	// the kind is not set in the typed objects retrieved from the server and the annotation is just a copy of the object
+	delete(object, "kind")
+	delete(object, "apiVersion")
+	if metadata, ok := object["metadata"].(map[string]interface{}); ok {
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			delete(annotations, LastAppliedConfigurationAnnotationKey)
+			if len(annotations) == 0 {
+				delete(metadata, "annotations")
+			}
+		}
+	}
+	result, err := yaml.Marshal(object)
+	return string(result), err
+}
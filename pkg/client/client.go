@@ -8,6 +8,7 @@ import (
 	"github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	corev1 "k8s.io/api/core/v1"
@@ -15,6 +16,10 @@ import (
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -23,6 +28,13 @@ const LastAppliedConfigurationAnnotationKey = "toolchain.dev.openshift.com/last-
 
 var log = logf.Log.WithName("apply_client")
 
+// builtInScheme contains only the built-in Kubernetes kinds, ie, the kinds that support the strategic merge patch
+var builtInScheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(builtInScheme))
+}
+
 // ApplyClient the client to use when creating or updating objects
 type ApplyClient struct {
 	client.Client
@@ -39,6 +51,9 @@ type applyObjectConfiguration struct {
 	owner             v1.Object
 	forceUpdate       bool
 	saveConfiguration bool
+	fieldManager      string
+	forceConflicts    bool
+	dryRun            bool
 }
 
 func newApplyObjectConfiguration(options ...ApplyObjectOption) applyObjectConfiguration {
@@ -78,33 +93,71 @@ func SaveConfiguration(saveConfiguration bool) ApplyObjectOption {
 	}
 }
 
+// ServerSideApply makes the resource applied using the Kubernetes server-side apply with the given field manager
+// instead of storing the whole object in the last-applied-configuration annotation and updating it (default: disabled).
+// Only the fields set in the object are owned by the field manager, so the fields owned by other controllers are preserved.
+// If the existing resource still contains the legacy last-applied-configuration annotation, then the annotation is removed.
+// The ForceUpdate and SaveConfiguration options are ignored when the server-side apply is used.
+func ServerSideApply(fieldManager string) ApplyObjectOption {
+	return func(config *applyObjectConfiguration) {
+		config.fieldManager = fieldManager
+	}
+}
+
+// ForceConflicts makes the server-side apply take the ownership of the fields that are owned by other field managers
+// instead of failing with a conflict (default: `false`). It has an effect only together with the ServerSideApply option.
+func ForceConflicts(forceConflicts bool) ApplyObjectOption {
+	return func(config *applyObjectConfiguration) {
+		config.forceConflicts = forceConflicts
+	}
+}
+
+// DryRun makes the requests sent to the server dry-run requests, so nothing is persisted (default: disabled).
+// The results of the dry-run contain the action that would be performed and the diff between the existing and the desired object.
+func DryRun() ApplyObjectOption {
+	return func(config *applyObjectConfiguration) {
+		config.dryRun = true
+	}
+}
+
 // ApplyRuntimeObject casts the provided object to client.Object and calls ApplyClient.ApplyObject method
 func (c ApplyClient) ApplyRuntimeObject(ctx context.Context, obj runtime.Object, options ...ApplyObjectOption) (bool, error) {
 	clientObj, ok := obj.(client.Object)
 	if !ok {
 		return false, fmt.Errorf("unable to cast of the object to client.Object: %+v", obj)
 	}
-	return c.applyObject(ctx, clientObj, options...)
+	result, err := c.applyObject(ctx, clientObj, options...)
+	return result.changed(), err
 }
 
 // ApplyObject creates the object if is missing and if the owner object is provided, then it's set as a controller reference.
 // If the objects exists then when the spec content has changed (based on the content of the annotation in the original object) then it
 // is automatically updated. If it looks to be same then based on the value of forceUpdate param it updates the object or not.
+// The object is updated using a three-way merge patch, so the fields set by other controllers are preserved.
 // The return boolean says if the object was either created or updated (`true`). If nothing changed (ie, the generation was not
 // incremented by the server), then it returns `false`.
 func (c ApplyClient) ApplyObject(ctx context.Context, obj client.Object, options ...ApplyObjectOption) (bool, error) {
+	result, err := c.ApplyObjectWithResult(ctx, obj, options...)
+	return result.changed(), err
+}
+
+// ApplyObjectWithResult applies the object the same way as ApplyObject does, but it returns the result of the apply
+// with the action that was performed (or that would be performed when the DryRun option is used).
+func (c ApplyClient) ApplyObjectWithResult(ctx context.Context, obj client.Object, options ...ApplyObjectOption) (*ApplyResult, error) {
 	gvk := obj.GetObjectKind().GroupVersionKind()
-	createdOrUpdated, err := c.applyObject(ctx, obj, options...)
+	result, err := c.applyObject(ctx, obj, options...)
 	if err != nil {
-		return createdOrUpdated, errors.Wrapf(err, "unable to create resource of kind: %s, version: %s", gvk.Kind, gvk.Version)
+		return result, errors.Wrapf(err, "unable to create resource of kind: %s, version: %s", gvk.Kind, gvk.Version)
 	}
-	return createdOrUpdated, nil
+	return result, nil
 }
 
-func (c ApplyClient) applyObject(ctx context.Context, obj client.Object, options ...ApplyObjectOption) (bool, error) {
-	// gets the meta accessor to the new resource
+func (c ApplyClient) applyObject(ctx context.Context, obj client.Object, options ...ApplyObjectOption) (*ApplyResult, error) {
 	// gets the meta accessor to the new resource
 	config := newApplyObjectConfiguration(options...)
+	if config.fieldManager != "" {
+		return c.serverSideApply(ctx, obj, config)
+	}
 
 	// creates a deepcopy of the new resource to be used to check if it already exists
 	existing := obj.DeepCopyObject().(client.Object)
@@ -124,9 +177,9 @@ func (c ApplyClient) applyObject(ctx context.Context, obj client.Object, options
 	namespacedName := types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}
 	if err := c.Client.Get(ctx, namespacedName, existing); err != nil {
 		if apierrors.IsNotFound(err) {
-			return true, c.createObj(ctx, obj, config.owner)
+			return c.createObj(ctx, obj, config)
 		}
-		return false, errors.Wrapf(err, "unable to get the resource '%v'", existing)
+		return noopResult(obj), errors.Wrapf(err, "unable to get the resource '%v'", existing)
 	}
 
 	// as it already exists, check using the UpdateStrategy if it should be updated
@@ -134,29 +187,215 @@ func (c ApplyClient) applyObject(ctx context.Context, obj client.Object, options
 		existingAnnotations := existing.GetAnnotations()
 		if existingAnnotations != nil {
 			if newConfiguration == existingAnnotations[LastAppliedConfigurationAnnotationKey] {
-				return false, nil
+				return newApplyResult(config, NoopAction, existing, existing), nil
 			}
 		}
 	}
 
-	// retrieve the current 'resourceVersion' to set it in the resource passed to the `client.Update()`
-	// otherwise we would get an error with the following message:
-	// `nstemplatetiers.toolchain.dev.openshift.com "base1ns" is invalid: metadata.resourceVersion: Invalid value: 0x0: must be specified for an update`
 	originalGeneration := existing.GetGeneration()
-	obj.SetResourceVersion(existing.GetResourceVersion())
 
 	// also, if the resource to create is a Service and there's a previous version, we should retain its `spec.ClusterIP`, otherwise
 	// the update will fail with the following error:
 	// `Service "<name>" is invalid: spec.clusterIP: Invalid value: "": field is immutable`
 	if err := RetainClusterIP(obj, existing); err != nil {
-		return false, err
+		return noopResult(obj), err
+	}
+	if _, found := lastAppliedConfiguration(existing); !found {
+		// without the last applied configuration, the fields removed from the object cannot be detected by the patch,
+		// so the whole object is updated.
+		// Retrieve the current 'resourceVersion' to set it in the resource passed to the `client.Update()`
+		// otherwise we would get an error with the following message:
+		// `nstemplatetiers.toolchain.dev.openshift.com "base1ns" is invalid: metadata.resourceVersion: Invalid value: 0x0: must be specified for an update`
+		obj.SetResourceVersion(existing.GetResourceVersion())
+		if err := c.Client.Update(ctx, obj, config.updateOptions()...); err != nil {
+			return noopResult(obj), errors.Wrapf(err, "unable to update the resource '%v'", obj)
+		}
+	} else {
+		patch, err := c.threeWayMergePatch(obj, existing)
+		if err != nil {
+			return noopResult(obj), errors.Wrapf(err, "unable to compute the patch of the resource '%v'", obj)
+		}
+		if patch == nil {
+			// nothing to change
+			return newApplyResult(config, NoopAction, existing, existing), nil
+		}
+		if err := c.Client.Patch(ctx, obj, patch, config.patchOptions()...); err != nil {
+			return noopResult(obj), errors.Wrapf(err, "unable to update the resource '%v'", obj)
+		}
 	}
-	if err := c.Client.Update(ctx, obj); err != nil {
-		return false, errors.Wrapf(err, "unable to update the resource '%v'", obj)
+	if config.dryRun {
+		return newApplyResult(config, UpdateAction, obj, existing), nil
 	}
 
 	// check if it was changed or not
-	return originalGeneration != obj.GetGeneration(), nil
+	if originalGeneration != obj.GetGeneration() {
+		return newApplyResult(config, UpdateAction, obj, existing), nil
+	}
+	return newApplyResult(config, NoopAction, obj, existing), nil
+}
+
+// threeWayMergePatch computes the patch between the last applied configuration stored in the annotation of the existing object,
+// the desired object and the existing (live) object, so only the fields that are (or were) applied are changed and the fields
+// set by other controllers are preserved. The strategic merge patch is used for the built-in Kubernetes kinds and the JSON merge
+// patch for all other kinds (eg. the custom resources). It returns `nil` if there is nothing to change.
+// The existing object is expected to contain the last applied configuration, otherwise no field would be removed by the patch.
+func (c ApplyClient) threeWayMergePatch(obj, existing client.Object) (client.Patch, error) {
+	lastApplied, _ := lastAppliedConfiguration(existing)
+	original, err := patchableContent(lastApplied)
+	if err != nil {
+		return nil, err
+	}
+	desired, err := marshalObjectContent(obj)
+	if err != nil {
+		return nil, err
+	}
+	modified, err := patchableContent(desired)
+	if err != nil {
+		return nil, err
+	}
+	current, err := marshalObjectContent(existing)
+	if err != nil {
+		return nil, err
+	}
+
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if gvk.Empty() {
+		if gvk, err = apiutil.GVKForObject(obj, c.Client.Scheme()); err != nil {
+			return nil, err
+		}
+	}
+	var patch []byte
+	var patchType types.PatchType
+	if versioned, err := builtInScheme.New(gvk); err == nil {
+		patchMeta, err := strategicpatch.NewPatchMetaFromStruct(versioned)
+		if err != nil {
+			return nil, err
+		}
+		if patch, err = strategicpatch.CreateThreeWayMergePatch(original, modified, current, patchMeta, true); err != nil {
+			return nil, err
+		}
+		patchType = types.StrategicMergePatchType
+	} else {
+		if patch, err = jsonmergepatch.CreateThreeWayJSONMergePatch(original, modified, current); err != nil {
+			return nil, err
+		}
+		patchType = types.MergePatchType
+	}
+	if string(patch) == "{}" {
+		return nil, nil
+	}
+	return client.RawPatch(patchType, patch), nil
+}
+
+// lastAppliedConfiguration returns the last applied configuration stored in the annotation of the given object,
+// and false if the annotation is missing or doesn't contain a valid JSON
+func lastAppliedConfiguration(obj client.Object) ([]byte, bool) {
+	lastApplied, found := obj.GetAnnotations()[LastAppliedConfigurationAnnotationKey]
+	if !found || !json.Valid([]byte(lastApplied)) {
+		return nil, false
+	}
+	return []byte(lastApplied), true
+}
+
+// patchableContent removes the status and the metadata fields that are set by the server from the given object content,
+// so they are not part of the patch
+func patchableContent(content []byte) ([]byte, error) {
+	object := map[string]interface{}{}
+	if err := json.Unmarshal(content, &object); err != nil {
+		return nil, err
+	}
+	delete(object, "status")
+	if metadata, ok := object["metadata"].(map[string]interface{}); ok {
+		for _, field := range []string{"resourceVersion", "generation", "uid", "creationTimestamp", "managedFields", "selfLink"} {
+			delete(metadata, field)
+		}
+	}
+	return json.Marshal(object)
+}
+
+// serverSideApply applies the given object using the server-side apply. The object is considered as updated
+// if the apply changed the existing object (ie, its resourceVersion was changed by the server).
+func (c ApplyClient) serverSideApply(ctx context.Context, obj client.Object, config applyObjectConfiguration) (*ApplyResult, error) {
+	// the kind has to be part of the applied configuration, but it's not set in the typed objects
+	if obj.GetObjectKind().GroupVersionKind().Empty() {
+		gvk, err := apiutil.GVKForObject(obj, c.Client.Scheme())
+		if err != nil {
+			return noopResult(obj), errors.Wrap(err, "unable to get the kind of the resource")
+		}
+		obj.GetObjectKind().SetGroupVersionKind(gvk)
+	}
+	if config.owner != nil {
+		// the owner reference is part of the applied configuration, so it has to be set every time, not only at creation
+		if err := controllerutil.SetControllerReference(config.owner, obj, c.Client.Scheme()); err != nil {
+			return noopResult(obj), errors.Wrap(err, "unable to set controller references")
+		}
+	}
+	// the legacy annotation is not owned by the field manager, so it must not be part of the applied configuration
+	if annotations := obj.GetAnnotations(); annotations != nil {
+		delete(annotations, LastAppliedConfigurationAnnotationKey)
+		obj.SetAnnotations(annotations)
+	}
+	// the applied configuration must not contain the managed fields and the resourceVersion would make the apply fail on any concurrent change
+	obj.SetManagedFields(nil)
+	obj.SetResourceVersion("")
+
+	existing := obj.DeepCopyObject().(client.Object)
+	if err := c.Client.Get(ctx, types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}, existing); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return noopResult(obj), errors.Wrapf(err, "unable to get the resource '%v'", existing)
+		}
+		existing = nil
+	}
+
+	patchOptions := append(config.patchOptions(), client.FieldOwner(config.fieldManager))
+	if config.forceConflicts {
+		patchOptions = append(patchOptions, client.ForceOwnership)
+	}
+	if err := c.Client.Patch(ctx, obj, client.Apply, patchOptions...); err != nil {
+		return noopResult(obj), errors.Wrapf(err, "unable to apply the resource '%v'", obj)
+	}
+	if existing == nil {
+		return newApplyResult(config, CreateAction, obj, nil), nil
+	}
+
+	action := NoopAction
+	if config.dryRun {
+		// the dry-run doesn't change the resourceVersion, so the objects have to be compared
+		if diff(existing, obj) != "" {
+			action = UpdateAction
+		}
+	} else if existing.GetResourceVersion() != obj.GetResourceVersion() {
+		action = UpdateAction
+	}
+
+	// migration from the client-side apply: remove the legacy annotation that was stored by the previous versions
+	if _, found := existing.GetAnnotations()[LastAppliedConfigurationAnnotationKey]; found {
+		action = UpdateAction
+		if !config.dryRun {
+			if err := c.removeLastAppliedConfiguration(ctx, obj); err != nil {
+				return newApplyResult(config, action, obj, existing), err
+			}
+		}
+	}
+	return newApplyResult(config, action, obj, existing), nil
+}
+
+// removeLastAppliedConfiguration removes the legacy last-applied-configuration annotation from the given object
+func (c ApplyClient) removeLastAppliedConfiguration(ctx context.Context, obj client.Object) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				LastAppliedConfigurationAnnotationKey: nil,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err := c.Client.Patch(ctx, obj, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		return errors.Wrapf(err, "unable to remove the annotation %s from the resource '%v'", LastAppliedConfigurationAnnotationKey, obj)
+	}
+	return nil
 }
 
 // RetainClusterIP sets the `spec.clusterIP` value from the given 'existing' object
@@ -211,31 +450,46 @@ func marshalObjectContent(newResource runtime.Object) ([]byte, error) {
 	return json.Marshal(newResource)
 }
 
-func (c ApplyClient) createObj(ctx context.Context, newResource client.Object, owner v1.Object) error {
-	if owner != nil {
-		err := controllerutil.SetControllerReference(owner, newResource, c.Client.Scheme())
+func (c ApplyClient) createObj(ctx context.Context, newResource client.Object, config applyObjectConfiguration) (*ApplyResult, error) {
+	if config.owner != nil {
+		err := controllerutil.SetControllerReference(config.owner, newResource, c.Client.Scheme())
 		if err != nil {
-			return errors.Wrap(err, "unable to set controller references")
+			return noopResult(newResource), errors.Wrap(err, "unable to set controller references")
 		}
 	}
-	return c.Client.Create(ctx, newResource)
+	// the result is computed once the owner is set, so the owner reference is part of the diff
+	result := newApplyResult(config, CreateAction, newResource, nil)
+	return result, c.Client.Create(ctx, newResource, config.createOptions()...)
 }
 
 // Apply applies the objects, ie, creates or updates them on the cluster
 // returns `true, nil` if at least one of the objects was created or modified,
-// `false, nil` if nothing changed, and `false, err` if an error occurred
-func (c ApplyClient) Apply(ctx context.Context, toolchainObjects []client.Object, newLabels map[string]string) (bool, error) {
-	createdOrUpdated := false
+// `false, nil` if nothing changed, and `false, err` if an error occurred.
+// The objects are always updated (see ForceUpdate) unless the given options say otherwise.
+func (c ApplyClient) Apply(ctx context.Context, toolchainObjects []client.Object, newLabels map[string]string, options ...ApplyObjectOption) (bool, error) {
+	results, err := c.ApplyWithResults(ctx, toolchainObjects, newLabels, options...)
+	if err != nil {
+		return false, err
+	}
+	return results.Changed(), nil
+}
+
+// ApplyWithResults applies the objects the same way as Apply does, but it returns the results of all applied objects.
+// Together with the DryRun option, it shows what would be changed on the cluster without changing anything.
+// If an error occurs, then the results of the objects that were applied before the error are returned together with the error.
+func (c ApplyClient) ApplyWithResults(ctx context.Context, toolchainObjects []client.Object, newLabels map[string]string, options ...ApplyObjectOption) (ApplyResults, error) {
+	options = append([]ApplyObjectOption{ForceUpdate(true)}, options...)
+	results := make(ApplyResults, 0, len(toolchainObjects))
 	for _, toolchainObject := range toolchainObjects {
 		MergeLabels(toolchainObject, newLabels)
 
-		result, err := c.ApplyObject(ctx, toolchainObject, ForceUpdate(true))
+		result, err := c.ApplyObjectWithResult(ctx, toolchainObject, options...)
 		if err != nil {
-			return false, errors.Wrapf(err, "unable to create resource of kind: %s, version: %s", toolchainObject.GetObjectKind().GroupVersionKind().Kind, toolchainObject.GetObjectKind().GroupVersionKind().Version)
+			return results, errors.Wrapf(err, "unable to create resource of kind: %s, version: %s", toolchainObject.GetObjectKind().GroupVersionKind().Kind, toolchainObject.GetObjectKind().GroupVersionKind().Version)
 		}
-		createdOrUpdated = createdOrUpdated || result
+		results = append(results, *result)
 	}
-	return createdOrUpdated, nil
+	return results, nil
 }
 
 // MergeLabels gets current exiting labels and merges them with the new ones provided
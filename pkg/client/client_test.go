@@ -16,11 +16,13 @@ import (
 	templatev1 "github.com/openshift/api/template/v1"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 
+	jsonpatch "github.com/evanphx/json-patch"
 	authv1 "github.com/openshift/api/authorization/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -340,6 +342,609 @@ func TestApplySingle(t *testing.T) {
 	})
 }
 
+func TestApplyThreeWayMergePatch(t *testing.T) {
+	// given
+	addToScheme(t)
+	namespacedName := types.NamespacedName{Namespace: "toolchain-host-operator", Name: "registration-service"}
+	newConfigMap := func(data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "registration-service",
+				Namespace: "toolchain-host-operator",
+			},
+			Data: data,
+		}
+	}
+
+	t.Run("it should preserve the fields set by other controllers", func(t *testing.T) {
+		// given
+		cl, cli := newClient(t)
+		_, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}))
+		require.NoError(t, err)
+		configMap := &corev1.ConfigMap{}
+		require.NoError(t, cli.Get(context.TODO(), namespacedName, configMap))
+		configMap.Data["other-param"] = "other-value"
+		configMap.Labels = map[string]string{"other-label": "other-value"}
+		require.NoError(t, cli.Update(context.TODO(), configMap))
+
+		// when
+		createdOrChanged, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "second-value"}))
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, createdOrChanged)
+		require.NoError(t, cli.Get(context.TODO(), namespacedName, configMap))
+		assert.Equal(t, map[string]string{"first-param": "second-value", "other-param": "other-value"}, configMap.Data)
+		assert.Equal(t, map[string]string{"other-label": "other-value"}, configMap.Labels)
+	})
+
+	t.Run("it should remove the fields that are not applied anymore", func(t *testing.T) {
+		// given
+		cl, cli := newClient(t)
+		_, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value", "second-param": "second-value"}))
+		require.NoError(t, err)
+
+		// when
+		createdOrChanged, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}))
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, createdOrChanged)
+		configMap := &corev1.ConfigMap{}
+		require.NoError(t, cli.Get(context.TODO(), namespacedName, configMap))
+		assert.Equal(t, map[string]string{"first-param": "first-value"}, configMap.Data)
+	})
+
+	t.Run("it should remove the fields when the configuration is not saved", func(t *testing.T) {
+		// given
+		cl, cli := newClient(t)
+		_, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value", "second-param": "second-value"}), client.SaveConfiguration(false))
+		require.NoError(t, err)
+
+		// when
+		createdOrChanged, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}), client.SaveConfiguration(false))
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, createdOrChanged)
+		configMap := &corev1.ConfigMap{}
+		require.NoError(t, cli.Get(context.TODO(), namespacedName, configMap))
+		assert.Equal(t, map[string]string{"first-param": "first-value"}, configMap.Data)
+		assert.NotContains(t, configMap.Annotations, client.LastAppliedConfigurationAnnotationKey)
+	})
+
+	t.Run("it should not update when there is nothing to change", func(t *testing.T) {
+		// given
+		cl, cli := newClient(t)
+		_, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}))
+		require.NoError(t, err)
+		cli.MockPatch = func(ctx context.Context, obj runtimeclient.Object, patch runtimeclient.Patch, opts ...runtimeclient.PatchOption) error {
+			return fmt.Errorf("should not be patched")
+		}
+
+		// when
+		createdOrChanged, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}), client.ForceUpdate(true))
+
+		// then
+		require.NoError(t, err)
+		assert.False(t, createdOrChanged)
+	})
+
+	t.Run("patch types", func(t *testing.T) {
+		unstructuredConfigMap, err := toUnstructured(&corev1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: metav1.ObjectMeta{Name: "registration-service", Namespace: "toolchain-host-operator"},
+			Data:       map[string]string{"first-param": "first-value"},
+		})
+		require.NoError(t, err)
+		tier := &toolchainv1alpha1.NSTemplateTier{
+			ObjectMeta: metav1.ObjectMeta{Name: "base", Namespace: "toolchain-host-operator"},
+			Spec: toolchainv1alpha1.NSTemplateTierSpec{
+				ClusterResources: &toolchainv1alpha1.NSTemplateTierClusterResources{TemplateRef: "base-clusterresources-123"},
+			},
+		}
+
+		for name, tc := range map[string]struct {
+			obj               runtimeclient.Object
+			modify            func(runtimeclient.Object)
+			expectedPatchType types.PatchType
+		}{
+			"built-in kind uses strategic merge patch": {
+				obj: newConfigMap(map[string]string{"first-param": "first-value"}),
+				modify: func(obj runtimeclient.Object) {
+					obj.(*corev1.ConfigMap).Data["first-param"] = "second-value"
+				},
+				expectedPatchType: types.StrategicMergePatchType,
+			},
+			"unstructured built-in kind uses strategic merge patch": {
+				obj: unstructuredConfigMap,
+				modify: func(obj runtimeclient.Object) {
+					require.NoError(t, unstructured.SetNestedField(obj.(*unstructured.Unstructured).Object, "second-value", "data", "first-param"))
+				},
+				expectedPatchType: types.StrategicMergePatchType,
+			},
+			"custom resource uses JSON merge patch": {
+				obj: tier,
+				modify: func(obj runtimeclient.Object) {
+					obj.(*toolchainv1alpha1.NSTemplateTier).Spec.ClusterResources.TemplateRef = "base-clusterresources-456"
+				},
+				expectedPatchType: types.MergePatchType,
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				// given
+				cl, cli := newClient(t)
+				_, err := cl.ApplyObject(context.TODO(), tc.obj.DeepCopyObject().(runtimeclient.Object))
+				require.NoError(t, err)
+				var patchTypes []types.PatchType
+				cli.MockPatch = func(ctx context.Context, obj runtimeclient.Object, patch runtimeclient.Patch, opts ...runtimeclient.PatchOption) error {
+					patchTypes = append(patchTypes, patch.Type())
+					return Patch(ctx, cli, obj, patch, opts...)
+				}
+				modified := tc.obj.DeepCopyObject().(runtimeclient.Object)
+				tc.modify(modified)
+
+				// when
+				createdOrChanged, err := cl.ApplyObject(context.TODO(), modified)
+
+				// then
+				require.NoError(t, err)
+				assert.True(t, createdOrChanged)
+				assert.Equal(t, []types.PatchType{tc.expectedPatchType}, patchTypes)
+			})
+		}
+	})
+}
+
+func TestServerSideApply(t *testing.T) {
+	// given
+	addToScheme(t)
+	namespacedName := types.NamespacedName{Namespace: "toolchain-host-operator", Name: "registration-service"}
+	newConfigMap := func(data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "registration-service",
+				Namespace: "toolchain-host-operator",
+			},
+			Data: data,
+		}
+	}
+
+	t.Run("when object is missing, it should create it", func(t *testing.T) {
+		// given
+		cl, cli, applied := newServerSideApplyClient(t)
+
+		// when
+		createdOrChanged, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}),
+			client.ServerSideApply("toolchain-operator"))
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, createdOrChanged)
+		require.Len(t, *applied, 1)
+		assertServerSideApply(t, (*applied)[0], "toolchain-operator", false)
+		assert.Equal(t, "ConfigMap", (*applied)[0].object["kind"])
+		configMap := &corev1.ConfigMap{}
+		require.NoError(t, cli.Get(context.TODO(), namespacedName, configMap))
+		assert.Equal(t, map[string]string{"first-param": "first-value"}, configMap.Data)
+		assert.NotContains(t, configMap.Annotations, client.LastAppliedConfigurationAnnotationKey)
+	})
+
+	t.Run("it should not update when the object is same", func(t *testing.T) {
+		// given
+		cl, _, applied := newServerSideApplyClient(t)
+		_, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}), client.ServerSideApply("toolchain-operator"))
+		require.NoError(t, err)
+
+		// when
+		createdOrChanged, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}), client.ServerSideApply("toolchain-operator"))
+
+		// then
+		require.NoError(t, err)
+		assert.False(t, createdOrChanged)
+		require.Len(t, *applied, 2)
+		assertServerSideApply(t, (*applied)[1], "toolchain-operator", false)
+	})
+
+	t.Run("it should update only the applied fields", func(t *testing.T) {
+		// given
+		cl, cli, _ := newServerSideApplyClient(t)
+		_, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}), client.ServerSideApply("toolchain-operator"))
+		require.NoError(t, err)
+		// another controller sets its own data
+		configMap := &corev1.ConfigMap{}
+		require.NoError(t, cli.Get(context.TODO(), namespacedName, configMap))
+		configMap.Data["other-param"] = "other-value"
+		require.NoError(t, cli.Update(context.TODO(), configMap))
+
+		// when
+		createdOrChanged, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "second-value"}), client.ServerSideApply("toolchain-operator"))
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, createdOrChanged)
+		require.NoError(t, cli.Get(context.TODO(), namespacedName, configMap))
+		assert.Equal(t, map[string]string{"first-param": "second-value", "other-param": "other-value"}, configMap.Data)
+	})
+
+	t.Run("it should strip the legacy last-applied-configuration annotation", func(t *testing.T) {
+		// given
+		cl, cli, applied := newServerSideApplyClient(t)
+		_, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}))
+		require.NoError(t, err)
+		configMap := &corev1.ConfigMap{}
+		require.NoError(t, cli.Get(context.TODO(), namespacedName, configMap))
+		require.Contains(t, configMap.Annotations, client.LastAppliedConfigurationAnnotationKey)
+
+		// when
+		createdOrChanged, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}), client.ServerSideApply("toolchain-operator"))
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, createdOrChanged)
+		require.NoError(t, cli.Get(context.TODO(), namespacedName, configMap))
+		assert.NotContains(t, configMap.Annotations, client.LastAppliedConfigurationAnnotationKey)
+		assert.Equal(t, map[string]string{"first-param": "first-value"}, configMap.Data)
+		// the configuration is applied and then the annotation is removed by a merge patch
+		require.Len(t, *applied, 2)
+		assertServerSideApply(t, (*applied)[0], "toolchain-operator", false)
+		assert.NotContains(t, fmt.Sprint((*applied)[0].object["metadata"]), client.LastAppliedConfigurationAnnotationKey)
+		assert.Equal(t, types.MergePatchType, (*applied)[1].patchType)
+
+		t.Run("and then it should not update anymore", func(t *testing.T) {
+			// when
+			createdOrChanged, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}), client.ServerSideApply("toolchain-operator"))
+
+			// then
+			require.NoError(t, err)
+			assert.False(t, createdOrChanged)
+		})
+	})
+
+	t.Run("it should force the conflicts and set the owner", func(t *testing.T) {
+		// given
+		cl, cli, applied := newServerSideApplyClient(t)
+		owner := &toolchainv1alpha1.NSTemplateSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "john",
+				Namespace: "toolchain-host-operator",
+				UID:       "john-uid",
+			},
+		}
+
+		// when
+		_, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}),
+			client.ServerSideApply("toolchain-operator"), client.ForceConflicts(true), client.SetOwner(owner))
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, *applied, 1)
+		assertServerSideApply(t, (*applied)[0], "toolchain-operator", true)
+		configMap := &corev1.ConfigMap{}
+		require.NoError(t, cli.Get(context.TODO(), namespacedName, configMap))
+		require.Len(t, configMap.OwnerReferences, 1)
+		assert.Equal(t, "john", configMap.OwnerReferences[0].Name)
+	})
+
+	t.Run("it should apply all objects", func(t *testing.T) {
+		// given
+		cl, cli, applied := newServerSideApplyClient(t)
+		objs := []runtimeclient.Object{
+			newConfigMap(map[string]string{"first-param": "first-value"}),
+			&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "registration-service", Namespace: "toolchain-host-operator"}},
+		}
+
+		// when
+		createdOrChanged, err := cl.Apply(context.TODO(), objs, map[string]string{"extra": "something-extra"}, client.ServerSideApply("toolchain-operator"))
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, createdOrChanged)
+		require.Len(t, *applied, 2)
+		for _, configuration := range *applied {
+			assertServerSideApply(t, configuration, "toolchain-operator", false)
+		}
+		sa := &corev1.ServiceAccount{}
+		require.NoError(t, cli.Get(context.TODO(), namespacedName, sa))
+		assert.Equal(t, map[string]string{"extra": "something-extra"}, sa.Labels)
+	})
+
+	t.Run("when the apply fails, then it should return an error", func(t *testing.T) {
+		// given
+		cl, cli, _ := newServerSideApplyClient(t)
+		cli.MockPatch = func(ctx context.Context, obj runtimeclient.Object, patch runtimeclient.Patch, opts ...runtimeclient.PatchOption) error {
+			return fmt.Errorf("conflict")
+		}
+
+		// when
+		createdOrChanged, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}), client.ServerSideApply("toolchain-operator"))
+
+		// then
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unable to apply the resource")
+		assert.Contains(t, err.Error(), "conflict")
+		assert.False(t, createdOrChanged)
+	})
+}
+
+func TestApplyDryRun(t *testing.T) {
+	// given
+	addToScheme(t)
+	namespacedName := types.NamespacedName{Namespace: "toolchain-host-operator", Name: "registration-service"}
+	newConfigMap := func(data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "v1",
+				Kind:       "ConfigMap",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "registration-service",
+				Namespace: "toolchain-host-operator",
+			},
+			Data: data,
+		}
+	}
+	assertConfigMapData := func(t *testing.T, cl runtimeclient.Client, expected map[string]string) {
+		configMap := &corev1.ConfigMap{}
+		require.NoError(t, cl.Get(context.TODO(), namespacedName, configMap))
+		assert.Equal(t, expected, configMap.Data)
+	}
+
+	t.Run("when object is missing, it should not create it", func(t *testing.T) {
+		// given
+		cl, cli := newClient(t)
+
+		// when
+		result, err := cl.ApplyObjectWithResult(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}), client.DryRun())
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, client.CreateAction, result.Action)
+		assert.Equal(t, `--- /dev/null
++++ desired ConfigMap toolchain-host-operator/registration-service
+@@ -0,0 +1,5 @@
++data:
++  first-param: first-value
++metadata:
++  name: registration-service
++  namespace: toolchain-host-operator
+`, result.Diff)
+		err = cli.Get(context.TODO(), namespacedName, &corev1.ConfigMap{})
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("when object is missing, it should show the owner reference in the diff", func(t *testing.T) {
+		// given
+		cl, cli := newClient(t)
+		owner := &toolchainv1alpha1.NSTemplateSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "john",
+				Namespace: "toolchain-host-operator",
+				UID:       "john-uid",
+			},
+		}
+
+		// when
+		result, err := cl.ApplyObjectWithResult(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}), client.DryRun(), client.SetOwner(owner))
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, client.CreateAction, result.Action)
+		assert.Contains(t, result.Diff, "+  ownerReferences:\n")
+		assert.Contains(t, result.Diff, "+    uid: john-uid\n")
+		err = cli.Get(context.TODO(), namespacedName, &corev1.ConfigMap{})
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("when object is different, it should not update it", func(t *testing.T) {
+		// given
+		cl, cli := newClient(t)
+		_, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}))
+		require.NoError(t, err)
+
+		// when
+		result, err := cl.ApplyObjectWithResult(context.TODO(), newConfigMap(map[string]string{"first-param": "second-value"}), client.DryRun())
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, client.UpdateAction, result.Action)
+		assert.Equal(t, `--- live ConfigMap toolchain-host-operator/registration-service
++++ desired ConfigMap toolchain-host-operator/registration-service
+@@ -1,5 +1,5 @@
+ data:
+-  first-param: first-value
++  first-param: second-value
+ metadata:
+   name: registration-service
+   namespace: toolchain-host-operator
+`, result.Diff)
+		assertConfigMapData(t, cli, map[string]string{"first-param": "first-value"})
+	})
+
+	t.Run("when object is same, it should return noop", func(t *testing.T) {
+		// given
+		cl, _ := newClient(t)
+		_, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}))
+		require.NoError(t, err)
+
+		// when
+		result, err := cl.ApplyObjectWithResult(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}), client.DryRun(), client.ForceUpdate(true))
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, client.NoopAction, result.Action)
+		assert.Empty(t, result.Diff)
+	})
+
+	t.Run("when only the last applied configuration is different, it should return noop", func(t *testing.T) {
+		// given
+		cl, cli := newClient(t)
+		_, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}), client.SaveConfiguration(false))
+		require.NoError(t, err)
+
+		// when
+		result, err := cl.ApplyObjectWithResult(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}), client.DryRun(), client.ForceUpdate(true))
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, client.NoopAction, result.Action)
+		assert.Empty(t, result.Diff)
+		configMap := &corev1.ConfigMap{}
+		require.NoError(t, cli.Get(context.TODO(), namespacedName, configMap))
+		assert.NotContains(t, configMap.Annotations, client.LastAppliedConfigurationAnnotationKey)
+	})
+
+	t.Run("with server-side apply", func(t *testing.T) {
+		// given
+		cl, cli, applied := newServerSideApplyClient(t)
+		_, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}))
+		require.NoError(t, err)
+
+		// when
+		result, err := cl.ApplyObjectWithResult(context.TODO(), newConfigMap(map[string]string{"first-param": "second-value"}),
+			client.ServerSideApply("toolchain-operator"), client.DryRun())
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, client.UpdateAction, result.Action)
+		assert.Contains(t, result.Diff, "-  first-param: first-value\n+  first-param: second-value\n")
+		require.Len(t, *applied, 1)
+		assertServerSideApply(t, (*applied)[0], "toolchain-operator", false)
+		assert.Equal(t, []string{metav1.DryRunAll}, (*applied)[0].options.DryRun)
+		configMap := &corev1.ConfigMap{}
+		require.NoError(t, cli.Get(context.TODO(), namespacedName, configMap))
+		assert.Equal(t, map[string]string{"first-param": "first-value"}, configMap.Data)
+		// the legacy annotation is not removed in dry-run
+		assert.Contains(t, configMap.Annotations, client.LastAppliedConfigurationAnnotationKey)
+	})
+
+	t.Run("it should return the results of all objects", func(t *testing.T) {
+		// given
+		cl, cli := newClient(t)
+		_, err := cl.ApplyObject(context.TODO(), newConfigMap(map[string]string{"first-param": "first-value"}))
+		require.NoError(t, err)
+		sa := &corev1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: metav1.ObjectMeta{Name: "registration-service", Namespace: "toolchain-host-operator"},
+		}
+		objs := []runtimeclient.Object{newConfigMap(map[string]string{"first-param": "second-value"}), sa}
+
+		// when
+		results, err := cl.ApplyWithResults(context.TODO(), objs, map[string]string{}, client.DryRun())
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.Equal(t, client.UpdateAction, results[0].Action)
+		assert.Equal(t, client.CreateAction, results[1].Action)
+		assert.True(t, results.Changed())
+		assert.Equal(t, results[0].Diff+results[1].Diff, results.Diff())
+		assertConfigMapData(t, cli, map[string]string{"first-param": "first-value"})
+		err = cli.Get(context.TODO(), namespacedName, &corev1.ServiceAccount{})
+		assert.True(t, apierrors.IsNotFound(err))
+
+		t.Run("and Apply should only report the change", func(t *testing.T) {
+			// when
+			createdOrUpdated, err := cl.Apply(context.TODO(), objs, map[string]string{}, client.DryRun())
+
+			// then
+			require.NoError(t, err)
+			assert.True(t, createdOrUpdated)
+			assertConfigMapData(t, cli, map[string]string{"first-param": "first-value"})
+		})
+	})
+
+	t.Run("when the apply fails, it should return the results of the objects applied before", func(t *testing.T) {
+		// given
+		cl, cli := newClient(t)
+		cli.MockCreate = func(ctx context.Context, obj runtimeclient.Object, opts ...runtimeclient.CreateOption) error {
+			if obj.GetObjectKind().GroupVersionKind().Kind == "ServiceAccount" {
+				return fmt.Errorf("forbidden")
+			}
+			return Create(ctx, cli, obj, opts...)
+		}
+		objs := []runtimeclient.Object{
+			newConfigMap(map[string]string{"first-param": "first-value"}),
+			&corev1.ServiceAccount{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+				ObjectMeta: metav1.ObjectMeta{Name: "registration-service", Namespace: "toolchain-host-operator"},
+			},
+		}
+
+		// when
+		results, err := cl.ApplyWithResults(context.TODO(), objs, map[string]string{}, client.DryRun())
+
+		// then
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "forbidden")
+		require.Len(t, results, 1)
+		assert.Equal(t, client.CreateAction, results[0].Action)
+	})
+}
+
+// appliedConfiguration is a patch request (eg. a server-side apply) received by the fake client
+type appliedConfiguration struct {
+	patchType types.PatchType
+	object    map[string]interface{}
+	options   *runtimeclient.PatchOptions
+}
+
+// assertServerSideApply verifies that the given request is a server-side apply with the given field manager that forces
+// the ownership of the conflicting fields only if expected
+func assertServerSideApply(t *testing.T, configuration appliedConfiguration, fieldManager string, force bool) {
+	assert.Equal(t, types.ApplyPatchType, configuration.patchType)
+	assert.Equal(t, fieldManager, configuration.options.FieldManager)
+	if force {
+		require.NotNil(t, configuration.options.Force)
+		assert.True(t, *configuration.options.Force)
+	} else {
+		assert.Nil(t, configuration.options.Force)
+	}
+}
+
+// newServerSideApplyClient returns an ApplyClient with a fake client that emulates the server-side apply (which is not supported
+// by the fake client) by creating the missing objects or by merging the applied configuration into the existing objects.
+func newServerSideApplyClient(t *testing.T) (*client.ApplyClient, *FakeClient, *[]appliedConfiguration) {
+	cl := NewFakeClient(t)
+	applied := &[]appliedConfiguration{}
+	cl.MockPatch = func(ctx context.Context, obj runtimeclient.Object, patch runtimeclient.Patch, opts ...runtimeclient.PatchOption) error {
+		data, err := patch.Data(obj)
+		require.NoError(t, err)
+		configuration := appliedConfiguration{patchType: patch.Type(), options: &runtimeclient.PatchOptions{}}
+		configuration.options.ApplyOptions(opts)
+		require.NoError(t, json.Unmarshal(data, &configuration.object))
+		*applied = append(*applied, configuration)
+		if patch.Type() != types.ApplyPatchType {
+			return cl.Client.Patch(ctx, obj, patch, opts...)
+		}
+
+		dryRun := len(configuration.options.DryRun) > 0
+		existing := obj.DeepCopyObject().(runtimeclient.Object)
+		if err := cl.Client.Get(ctx, runtimeclient.ObjectKeyFromObject(obj), existing); err != nil {
+			if apierrors.IsNotFound(err) && !dryRun {
+				return cl.Client.Create(ctx, obj)
+			}
+			if apierrors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+		existingData, err := json.Marshal(existing)
+		require.NoError(t, err)
+		merged, err := jsonpatch.MergePatch(existingData, data)
+		require.NoError(t, err)
+		if err := json.Unmarshal(merged, obj); err != nil {
+			return err
+		}
+		// compare the objects, not the JSONs, because the merge patch removes the null fields (eg. the creationTimestamp)
+		if dryRun || reflect.DeepEqual(existing, obj) {
+			return nil
+		}
+		return cl.Client.Update(ctx, obj)
+	}
+	return client.NewApplyClient(cl), cl, applied
+}
+
 func toUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
 	content, err := json.Marshal(obj)
 	if err != nil {
@@ -585,12 +1190,13 @@ func TestProcessAndApply(t *testing.T) {
 	t.Run("should update existing role binding", func(t *testing.T) {
 		// given
 		cl := NewFakeClient(t)
-		cl.MockUpdate = func(ctx context.Context, obj runtimeclient.Object, opts ...runtimeclient.UpdateOption) error {
-			t.Logf("updating resource of kind %s with version %s\n", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetResourceVersion())
-			if obj.GetObjectKind().GroupVersionKind().Kind == "RoleBinding" && obj.GetResourceVersion() != "1" {
-				return fmt.Errorf("invalid resource version: %q", obj.GetResourceVersion())
+		cl.MockPatch = func(ctx context.Context, obj runtimeclient.Object, patch runtimeclient.Patch, opts ...runtimeclient.PatchOption) error {
+			t.Logf("patching resource of kind %s with patch type %s\n", obj.GetObjectKind().GroupVersionKind().Kind, patch.Type())
+			// the OpenShift RoleBinding is not a built-in Kubernetes kind, so it doesn't support the strategic merge patch
+			if obj.GetObjectKind().GroupVersionKind().Kind == "RoleBinding" && patch.Type() != types.MergePatchType {
+				return fmt.Errorf("invalid patch type: %q", patch.Type())
 			}
-			return cl.Client.Update(ctx, obj, opts...)
+			return Patch(ctx, cl, obj, patch, opts...)
 		}
 		p := template.NewProcessor(s)
 		tmpl, err := DecodeTemplate(decoder,
@@ -676,7 +1282,7 @@ func TestProcessAndApply(t *testing.T) {
 			// given
 			cl := NewFakeClient(t)
 			p := template.NewProcessor(s)
-			cl.MockUpdate = func(ctx context.Context, obj runtimeclient.Object, opts ...runtimeclient.UpdateOption) error {
+			cl.MockPatch = func(ctx context.Context, obj runtimeclient.Object, patch runtimeclient.Patch, opts ...runtimeclient.PatchOption) error {
 				return errors.New("failed to update resource")
 			}
 			tmpl, err := DecodeTemplate(decoder,
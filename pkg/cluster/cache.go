@@ -1,19 +1,67 @@
 package cluster
 
 import (
+	"context"
+	"sort"
+	"strconv"
 	"sync"
+	"time"
 
 	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	runtimecluster "sigs.k8s.io/controller-runtime/pkg/cluster"
 )
 
-var clusterCache = toolchainClusterClients{clusters: map[string]*CachedToolchainCluster{}}
+// clusterCache is the default instance of the cache used by the package-level functions
+// as well as by the ToolchainClusterService instances that are not given any explicit cache
+var clusterCache = NewClusterCache()
 
-type toolchainClusterClients struct {
+// ClusterCache stores the CachedToolchainClusters (indexed by their names).
+// Every ToolchainClusterService is bound to a single ClusterCache instance which is then refreshed
+// by the service whenever a cluster is not found in the cache.
+type ClusterCache struct {
 	sync.RWMutex
-	clusters     map[string]*CachedToolchainCluster
-	refreshCache func()
+	clusters      map[string]*CachedToolchainCluster
+	refreshCache  func()
+	subscriptions subscriptions
+	lastResync    time.Time
+	refresher     refresher
+	// notFound contains the names of the clusters that were not found even after refreshing the cache (with the time of the refresh)
+	notFound map[string]time.Time
+	// negativeCacheTTL is for how long the refresh is skipped for a name that was not found even after refreshing the cache
+	negativeCacheTTL time.Duration
+	// selectedHost is the name of the host cluster that was returned by the last call of GetHostCluster
+	selectedHost string
+}
+
+// CacheOption an option to configure the ClusterCache
+type CacheOption func(*ClusterCache)
+
+// WithNegativeCacheTTL makes the cache remember the names of the clusters that were not found even after refreshing the cache,
+// so the subsequent lookups of the same name within the given TTL don't trigger another refresh
+func WithNegativeCacheTTL(ttl time.Duration) CacheOption {
+	return func(cache *ClusterCache) {
+		cache.negativeCacheTTL = ttl
+	}
+}
+
+// DefaultClusterCache returns the default instance of ClusterCache that is used by the package-level functions
+func DefaultClusterCache() *ClusterCache {
+	return clusterCache
+}
+
+// NewClusterCache creates a new empty instance of ClusterCache
+func NewClusterCache(options ...CacheOption) *ClusterCache {
+	cache := &ClusterCache{
+		clusters: map[string]*CachedToolchainCluster{},
+		notFound: map[string]time.Time{},
+	}
+	for _, configure := range options {
+		configure(cache)
+	}
+	return cache
 }
 
 type Config struct {
@@ -21,6 +69,8 @@ type Config struct {
 	RestConfig *rest.Config
 	// Name is the name of the cluster. Has to be unique - is used as a key in a map.
 	Name string
+	// Namespace is the namespace of the corresponding ToolchainCluster
+	Namespace string
 	// APIEndpoint is the API endpoint of the corresponding ToolchainCluster. This can be a hostname,
 	// hostname:port, IP or IP:port.
 	APIEndpoint string
@@ -37,42 +87,117 @@ type Config struct {
 	// Labels contains all the labels of the corresponding ToolchainCluster.
 	// They will be used for filtering ToolchainCluster's based on a given list of cluster-role labels.
 	Labels map[string]string `json:"labels,omitempty"`
+
+	// ClientSettings contains the effective settings (QPS, burst, timeout and user agent) of the client of the cluster
+	ClientSettings ClientSettings
 }
 
 // CachedToolchainCluster stores cluster client; cluster related info and previous health check probe results
 type CachedToolchainCluster struct {
 	*Config
 	// Client is the kube client for the cluster.
+	// When the informer cache is enabled in the ToolchainClusterService, then the client reads from the cache of the Cluster.
 	Client client.Client
+	// Cluster provides the shared informer cache of the cluster. It is nil unless the informer cache is enabled
+	// in the ToolchainClusterService.
+	Cluster runtimecluster.Cluster
+	// Clientset is the typed kube clientset for the cluster. It is created together with the Client and is reused
+	// as long as the config of the cluster doesn't change.
+	Clientset kubernetes.Interface
+	// stop stops the informer cache of the Cluster (if any)
+	stop context.CancelFunc
 	// ClusterStatus is the cluster result as of the last health check probe.
 	ClusterStatus *toolchainv1alpha1.ToolchainClusterStatus
 }
 
-func (c *toolchainClusterClients) addCachedToolchainCluster(cluster *CachedToolchainCluster) {
+func (c *ClusterCache) addCachedToolchainCluster(cluster *CachedToolchainCluster) {
 	c.Lock()
-	defer c.Unlock()
+	old := c.clusters[cluster.Name]
 	c.clusters[cluster.Name] = cluster
+	delete(c.notFound, cluster.Name)
+	c.Unlock()
+	if old != nil && old.Cluster != cluster.Cluster {
+		old.stopCluster()
+	}
+	// notify the subscribers outside of the lock so they can read the cache while handling the event
+	c.notify(newAddOrUpdateEvent(old, cluster))
 }
 
-func (c *toolchainClusterClients) deleteCachedToolchainCluster(name string) {
+func (c *ClusterCache) deleteCachedToolchainCluster(name string) {
 	c.Lock()
-	defer c.Unlock()
+	old, exists := c.clusters[name]
 	delete(c.clusters, name)
+	c.Unlock()
+	if exists {
+		old.stopCluster()
+		c.notify(Event{Type: ClusterRemoved, Old: old})
+	}
 }
 
-func (c *toolchainClusterClients) getCachedToolchainCluster(name string, canRefreshCache bool) (*CachedToolchainCluster, bool) {
+// deleteCachedToolchainClustersExcept deletes all clusters whose names are not in the given set and returns the names of the deleted ones
+func (c *ClusterCache) deleteCachedToolchainClustersExcept(names map[string]bool) []string {
+	c.Lock()
+	var deleted []*CachedToolchainCluster
+	for name, cluster := range c.clusters {
+		if !names[name] {
+			deleted = append(deleted, cluster)
+			delete(c.clusters, name)
+		}
+	}
+	c.Unlock()
+
+	deletedNames := make([]string, 0, len(deleted))
+	for _, cluster := range deleted {
+		cluster.stopCluster()
+		deletedNames = append(deletedNames, cluster.Name)
+		c.notify(Event{Type: ClusterRemoved, Old: cluster})
+	}
+	return deletedNames
+}
+
+func (c *ClusterCache) setLastResyncTime(t time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	c.lastResync = t
+}
+
+// LastResyncTime returns the time of the last successful resync of the cache, or zero time if there wasn't any
+func (c *ClusterCache) LastResyncTime() time.Time {
 	c.RLock()
 	defer c.RUnlock()
-	_, ok := c.clusters[name]
-	if !ok && canRefreshCache && c.refreshCache != nil {
-		c.RUnlock()
-		c.refreshCache()
-		c.RLock()
+	return c.lastResync
+}
+
+func (c *ClusterCache) getCachedToolchainCluster(name string, canRefreshCache bool) (*CachedToolchainCluster, bool) {
+	generation := c.refresher.generation()
+	cluster, ok, knownAsNotFound := c.get(name)
+	if ok || !canRefreshCache || knownAsNotFound {
+		return cluster, ok
+	}
+	c.refresh(generation)
+
+	c.Lock()
+	defer c.Unlock()
+	cluster, ok = c.clusters[name]
+	if !ok && c.negativeCacheTTL > 0 {
+		c.notFound[name] = time.Now()
 	}
-	cluster, ok := c.clusters[name]
 	return cluster, ok
 }
 
+// get returns the cluster with the given name, if it's in the cache, and info if the name is known as not found
+// (and thus the cache shouldn't be refreshed)
+func (c *ClusterCache) get(name string) (*CachedToolchainCluster, bool, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	cluster, ok := c.clusters[name]
+	if ok {
+		return cluster, true, false
+	}
+	notFoundTime, knownAsNotFound := c.notFound[name]
+	return nil, false, knownAsNotFound && time.Since(notFoundTime) < c.negativeCacheTTL
+}
+
 // Condition an expected cluster condition
 type Condition func(cluster *CachedToolchainCluster) bool
 
@@ -81,7 +206,54 @@ var Ready Condition = func(cluster *CachedToolchainCluster) bool {
 	return IsReady(cluster.ClusterStatus)
 }
 
-func (c *toolchainClusterClients) getCachedToolchainClustersByType(clusterType Type, conditions ...Condition) []*CachedToolchainCluster {
+// WithRole checks that the cluster has the given role
+func WithRole(role Role) Condition {
+	return func(cluster *CachedToolchainCluster) bool {
+		return hasRole(cluster, role)
+	}
+}
+
+// WithAllRoles checks that the cluster has all the given roles
+func WithAllRoles(roles ...Role) Condition {
+	return func(cluster *CachedToolchainCluster) bool {
+		for _, role := range roles {
+			if !hasRole(cluster, role) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// WithAnyRole checks that the cluster has at least one of the given roles
+func WithAnyRole(roles ...Role) Condition {
+	return func(cluster *CachedToolchainCluster) bool {
+		for _, role := range roles {
+			if hasRole(cluster, role) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// WithoutRole checks that the cluster doesn't have the given role
+func WithoutRole(role Role) Condition {
+	return func(cluster *CachedToolchainCluster) bool {
+		return !hasRole(cluster, role)
+	}
+}
+
+// hasRole checks if the cluster has the label of the given role. Only the label key matters, the value is not used.
+func hasRole(cluster *CachedToolchainCluster, role Role) bool {
+	if cluster.Config == nil {
+		return false
+	}
+	_, found := cluster.Labels[RoleLabel(role)]
+	return found
+}
+
+func (c *ClusterCache) getCachedToolchainClustersByType(clusterType Type, conditions ...Condition) []*CachedToolchainCluster {
 	c.RLock()
 	defer c.RUnlock()
 	return Filter(clusterType, c.clusters, conditions...)
@@ -103,8 +275,96 @@ clusters:
 }
 
 // GetCachedToolchainCluster returns a kube client for the cluster (with the given name) and info if the client exists
+func (c *ClusterCache) GetCachedToolchainCluster(name string) (*CachedToolchainCluster, bool) {
+	return c.getCachedToolchainCluster(name, true)
+}
+
+// GetHostCluster returns the kube client for the host cluster from the cache of the clusters
+// and info if such a client exists.
+// If there are multiple host clusters, then the previously selected one is returned as long as it's ready. Otherwise,
+// the first of the candidates returned by GetHostClusterCandidates is selected (and recorded in the cache), so there is an
+// automatic failover to another ready host cluster when the selected one goes offline.
+func (c *ClusterCache) GetHostCluster() (*CachedToolchainCluster, bool) {
+	generation := c.refresher.generation()
+	candidates := c.GetHostClusterCandidates()
+	if len(candidates) == 0 {
+		c.refresh(generation)
+		candidates = c.GetHostClusterCandidates()
+		if len(candidates) == 0 {
+			return nil, false
+		}
+	}
+	return c.selectHost(candidates), true
+}
+
+// GetHostClusterCandidates returns all host clusters from the cache sorted by the preference of the host selection:
+// the ready clusters first, then the clusters with a higher value of the HostPriorityLabel, and then by name
+func (c *ClusterCache) GetHostClusterCandidates() []*CachedToolchainCluster {
+	candidates := c.getCachedToolchainClustersByType(Host)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if readyI, readyJ := isClusterReady(candidates[i]), isClusterReady(candidates[j]); readyI != readyJ {
+			return readyI
+		}
+		if priorityI, priorityJ := hostPriority(candidates[i]), hostPriority(candidates[j]); priorityI != priorityJ {
+			return priorityI > priorityJ
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+	return candidates
+}
+
+// SelectedHostName returns the name of the host cluster that was selected by the last call of GetHostCluster
+func (c *ClusterCache) SelectedHostName() string {
+	c.RLock()
+	defer c.RUnlock()
+	return c.selectedHost
+}
+
+func (c *ClusterCache) selectHost(candidates []*CachedToolchainCluster) *CachedToolchainCluster {
+	c.Lock()
+	defer c.Unlock()
+	for _, candidate := range candidates {
+		if candidate.Name == c.selectedHost && isClusterReady(candidate) {
+			return candidate
+		}
+	}
+	c.selectedHost = candidates[0].Name
+	return candidates[0]
+}
+
+// hostPriority returns the priority set in the HostPriorityLabel of the cluster, or 0 if the label is missing or invalid
+func hostPriority(cluster *CachedToolchainCluster) int {
+	if cluster.Config == nil {
+		return 0
+	}
+	priority, err := strconv.Atoi(cluster.Labels[HostPriorityLabel])
+	if err != nil {
+		return 0
+	}
+	return priority
+}
+
+// GetMemberClusters returns the kube clients for the member clusters from the cache of the clusters
+func (c *ClusterCache) GetMemberClusters(conditions ...Condition) []*CachedToolchainCluster {
+	generation := c.refresher.generation()
+	clusters := c.getCachedToolchainClustersByType(Member, conditions...)
+	if len(clusters) == 0 {
+		c.refresh(generation)
+		clusters = c.getCachedToolchainClustersByType(Member, conditions...)
+	}
+	return clusters
+}
+
+// GetMemberClustersByRoles returns the kube clients for the member clusters that have all the given roles
+// and that match the given conditions. The cache is refreshed when no such member cluster is found.
+func (c *ClusterCache) GetMemberClustersByRoles(roles []Role, conditions ...Condition) []*CachedToolchainCluster {
+	return c.GetMemberClusters(append([]Condition{WithAllRoles(roles...)}, conditions...)...)
+}
+
+// GetCachedToolchainCluster returns a kube client for the cluster (with the given name) and info if the client exists
+// It uses the default instance of the ClusterCache.
 func GetCachedToolchainCluster(name string) (*CachedToolchainCluster, bool) {
-	return clusterCache.getCachedToolchainCluster(name, true)
+	return clusterCache.GetCachedToolchainCluster(name)
 }
 
 // GetHostClusterFunc a func that returns the Host cluster from the cache,
@@ -114,20 +374,15 @@ type GetHostClusterFunc func() (*CachedToolchainCluster, bool)
 // HostCluster the func to retrieve the host cluster
 var HostCluster GetHostClusterFunc = GetHostCluster
 
-// GetHostCluster returns the kube client for the host cluster from the cache of the clusters
+// GetHostCluster returns the kube client for the host cluster from the default cache of the clusters
 // and info if such a client exists
 func GetHostCluster() (*CachedToolchainCluster, bool) {
-	clusters := clusterCache.getCachedToolchainClustersByType(Host)
-	if len(clusters) == 0 {
-		if clusterCache.refreshCache != nil {
-			clusterCache.refreshCache()
-		}
-		clusters = clusterCache.getCachedToolchainClustersByType(Host)
-		if len(clusters) == 0 {
-			return nil, false
-		}
-	}
-	return clusters[0], true
+	return clusterCache.GetHostCluster()
+}
+
+// GetHostClusterCandidates returns all host clusters from the default cache of the clusters sorted by the preference of the host selection
+func GetHostClusterCandidates() []*CachedToolchainCluster {
+	return clusterCache.GetHostClusterCandidates()
 }
 
 // GetMemberClustersFunc a func that returns the member clusters from the cache
@@ -136,16 +391,15 @@ type GetMemberClustersFunc func(conditions ...Condition) []*CachedToolchainClust
 // MemberClusters the func to retrieve the member clusters
 var MemberClusters GetMemberClustersFunc = GetMemberClusters
 
-// GetMemberClusters returns the kube clients for the host clusters from the cache of the clusters
+// GetMemberClusters returns the kube clients for the member clusters from the default cache of the clusters
 func GetMemberClusters(conditions ...Condition) []*CachedToolchainCluster {
-	clusters := clusterCache.getCachedToolchainClustersByType(Member, conditions...)
-	if len(clusters) == 0 {
-		if clusterCache.refreshCache != nil {
-			clusterCache.refreshCache()
-		}
-		clusters = clusterCache.getCachedToolchainClustersByType(Member, conditions...)
-	}
-	return clusters
+	return clusterCache.GetMemberClusters(conditions...)
+}
+
+// GetMemberClustersByRoles returns the kube clients for the member clusters from the default cache of the clusters
+// that have all the given roles and that match the given conditions
+func GetMemberClustersByRoles(roles []Role, conditions ...Condition) []*CachedToolchainCluster {
+	return clusterCache.GetMemberClustersByRoles(roles, conditions...)
 }
 
 // Type is a cluster type (either host or member)
@@ -156,6 +410,10 @@ const (
 	Host   Type = "host"
 )
 
+// HostPriorityLabel is the key of the ToolchainCluster label containing the priority of the host cluster (an integer).
+// When there are multiple ready host clusters, then the one with the highest priority is selected.
+const HostPriorityLabel = toolchainv1alpha1.LabelKeyPrefix + "host-priority"
+
 // Role defines the role of the cluster.
 // Each type of cluster can have multiple roles (tenant for specific APIs, user workloads, others ... )
 type Role string
@@ -2,7 +2,9 @@ package cluster
 
 import (
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
 	"github.com/codeready-toolchain/toolchain-common/pkg/test"
@@ -279,6 +281,280 @@ func TestGetClustersByType(t *testing.T) {
 	})
 }
 
+func TestIndependentClusterCaches(t *testing.T) {
+	// given
+	defer resetClusterCache()
+	cache1 := NewClusterCache()
+	cache2 := NewClusterCache()
+	member1 := newTestCachedToolchainCluster(t, "member-1", Member, ready)
+	host1 := newTestCachedToolchainCluster(t, "host-1", Host, ready)
+	cache1.addCachedToolchainCluster(member1)
+	cache1.addCachedToolchainCluster(host1)
+	member2 := newTestCachedToolchainCluster(t, "member-2", Member, ready)
+	cache2.addCachedToolchainCluster(member2)
+	refreshed2 := false
+	cache2.refreshCache = func() {
+		refreshed2 = true
+	}
+
+	t.Run("get cluster by name", func(t *testing.T) {
+		// when
+		returnedCluster, ok := cache1.GetCachedToolchainCluster("member-1")
+
+		// then
+		assert.True(t, ok)
+		assert.Equal(t, member1, returnedCluster)
+
+		// when
+		returnedCluster, ok = cache2.GetCachedToolchainCluster("member-1")
+
+		// then
+		assert.False(t, ok)
+		assert.Nil(t, returnedCluster)
+		assert.True(t, refreshed2)
+	})
+
+	t.Run("get host cluster", func(t *testing.T) {
+		// when
+		returnedCluster, ok := cache1.GetHostCluster()
+
+		// then
+		assert.True(t, ok)
+		assert.Equal(t, host1, returnedCluster)
+
+		// when
+		returnedCluster, ok = cache2.GetHostCluster()
+
+		// then
+		assert.False(t, ok)
+		assert.Nil(t, returnedCluster)
+	})
+
+	t.Run("get member clusters", func(t *testing.T) {
+		// when
+		clusters1 := cache1.GetMemberClusters(Ready)
+		clusters2 := cache2.GetMemberClusters(Ready)
+
+		// then
+		require.Len(t, clusters1, 1)
+		assert.Equal(t, member1, clusters1[0])
+		require.Len(t, clusters2, 1)
+		assert.Equal(t, member2, clusters2[0])
+	})
+
+	t.Run("default cache is not affected", func(t *testing.T) {
+		// when
+		_, ok := GetHostCluster()
+
+		// then
+		assert.False(t, ok)
+		assert.Empty(t, GetMemberClusters())
+	})
+}
+
+func TestGetMemberClustersByRoles(t *testing.T) {
+	// given
+	workloads := Role("workloads")
+	vip := Role("vip")
+	tenant := newTestCachedToolchainCluster(t, "cluster-tenant", Member, ready, withRoles(Tenant))
+	tenantWorkloads := newTestCachedToolchainCluster(t, "cluster-tenant-workloads", Member, ready, withRoles(Tenant, workloads))
+	notReadyTenantWorkloads := newTestCachedToolchainCluster(t, "cluster-tenant-workloads-not-ready", Member, notReady, withRoles(Tenant, workloads))
+	vipOnly := newTestCachedToolchainCluster(t, "cluster-vip", Member, ready, withRoles(vip))
+	noRole := newTestCachedToolchainCluster(t, "cluster-no-role", Member, ready)
+	host := newTestCachedToolchainCluster(t, "cluster-host", Host, ready, withRoles(Tenant))
+
+	setup := func() {
+		resetClusterCache()
+		for _, cluster := range []*CachedToolchainCluster{tenant, tenantWorkloads, notReadyTenantWorkloads, vipOnly, noRole, host} {
+			clusterCache.addCachedToolchainCluster(cluster)
+		}
+	}
+
+	t.Run("with role", func(t *testing.T) {
+		// given
+		setup()
+		defer resetClusterCache()
+
+		// when
+		clusters := GetMemberClusters(WithRole(Tenant))
+
+		// then
+		assert.ElementsMatch(t, []*CachedToolchainCluster{tenant, tenantWorkloads, notReadyTenantWorkloads}, clusters)
+	})
+
+	t.Run("with all roles", func(t *testing.T) {
+		// given
+		setup()
+		defer resetClusterCache()
+
+		// when
+		clusters := GetMemberClusters(WithAllRoles(Tenant, workloads), Ready)
+
+		// then
+		assert.ElementsMatch(t, []*CachedToolchainCluster{tenantWorkloads}, clusters)
+	})
+
+	t.Run("with any role", func(t *testing.T) {
+		// given
+		setup()
+		defer resetClusterCache()
+
+		// when
+		clusters := GetMemberClusters(WithAnyRole(workloads, vip), Ready)
+
+		// then
+		assert.ElementsMatch(t, []*CachedToolchainCluster{tenantWorkloads, vipOnly}, clusters)
+	})
+
+	t.Run("without role", func(t *testing.T) {
+		// given
+		setup()
+		defer resetClusterCache()
+
+		// when
+		clusters := GetMemberClusters(WithoutRole(Tenant))
+
+		// then
+		assert.ElementsMatch(t, []*CachedToolchainCluster{vipOnly, noRole}, clusters)
+	})
+
+	t.Run("by roles", func(t *testing.T) {
+		// given
+		setup()
+		defer resetClusterCache()
+
+		// when
+		clusters := GetMemberClustersByRoles([]Role{Tenant, workloads}, Ready)
+
+		// then
+		assert.ElementsMatch(t, []*CachedToolchainCluster{tenantWorkloads}, clusters)
+	})
+
+	t.Run("by roles found after refreshing the cache", func(t *testing.T) {
+		// given
+		defer resetClusterCache()
+		clusterCache.addCachedToolchainCluster(tenant)
+		called := false
+		clusterCache.refreshCache = func() {
+			called = true
+			clusterCache.addCachedToolchainCluster(vipOnly)
+		}
+
+		// when
+		clusters := GetMemberClustersByRoles([]Role{vip})
+
+		// then
+		assert.ElementsMatch(t, []*CachedToolchainCluster{vipOnly}, clusters)
+		assert.True(t, called)
+	})
+
+	t.Run("by roles not found", func(t *testing.T) {
+		// given
+		setup()
+		defer resetClusterCache()
+
+		// when
+		clusters := GetMemberClustersByRoles([]Role{"unknown"})
+
+		// then
+		assert.Empty(t, clusters)
+	})
+}
+
+func TestMultipleHostClusters(t *testing.T) {
+	// given
+	withPriority := func(priority string) clusterOption {
+		return func(c *CachedToolchainCluster) {
+			c.Labels = map[string]string{HostPriorityLabel: priority}
+		}
+	}
+	hostA := newTestCachedToolchainCluster(t, "host-a", Host, ready)
+	hostB := newTestCachedToolchainCluster(t, "host-b", Host, ready, withPriority("10"))
+	hostC := newTestCachedToolchainCluster(t, "host-c", Host, ready, withPriority("10"))
+	notReadyHostD := newTestCachedToolchainCluster(t, "host-d", Host, notReady, withPriority("100"))
+	member := newTestCachedToolchainCluster(t, "member", Member, ready)
+
+	t.Run("candidates are sorted by readiness, priority and name", func(t *testing.T) {
+		// given
+		cache := NewClusterCache()
+		for _, cluster := range []*CachedToolchainCluster{notReadyHostD, hostC, member, hostA, hostB} {
+			cache.addCachedToolchainCluster(cluster)
+		}
+
+		// when
+		candidates := cache.GetHostClusterCandidates()
+
+		// then
+		assert.Equal(t, []*CachedToolchainCluster{hostB, hostC, hostA, notReadyHostD}, candidates)
+	})
+
+	t.Run("selection is deterministic", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			// given
+			cache := NewClusterCache()
+			for _, cluster := range []*CachedToolchainCluster{notReadyHostD, hostC, member, hostA, hostB} {
+				cache.addCachedToolchainCluster(cluster)
+			}
+
+			// when
+			host, ok := cache.GetHostCluster()
+
+			// then
+			require.True(t, ok)
+			assert.Equal(t, hostB, host)
+			assert.Equal(t, "host-b", cache.SelectedHostName())
+		}
+	})
+
+	t.Run("failover", func(t *testing.T) {
+		// given
+		cache := NewClusterCache()
+		for _, cluster := range []*CachedToolchainCluster{hostA, hostB, hostC} {
+			cache.addCachedToolchainCluster(cluster)
+		}
+		host, ok := cache.GetHostCluster()
+		require.True(t, ok)
+		require.Equal(t, hostB, host)
+
+		t.Run("to the next ready host when the selected one goes offline", func(t *testing.T) {
+			// given
+			cache.addCachedToolchainCluster(newTestCachedToolchainCluster(t, "host-b", Host, notReady, withPriority("10")))
+
+			// when
+			host, ok := cache.GetHostCluster()
+
+			// then
+			require.True(t, ok)
+			assert.Equal(t, hostC, host)
+			assert.Equal(t, "host-c", cache.SelectedHostName())
+		})
+
+		t.Run("stays on the selected host when the previous one is ready again", func(t *testing.T) {
+			// given
+			cache.addCachedToolchainCluster(hostB)
+
+			// when
+			host, ok := cache.GetHostCluster()
+
+			// then
+			require.True(t, ok)
+			assert.Equal(t, hostC, host)
+		})
+
+		t.Run("to the next ready host when the selected one is removed", func(t *testing.T) {
+			// given
+			cache.deleteCachedToolchainCluster("host-c")
+
+			// when
+			host, ok := cache.GetHostCluster()
+
+			// then
+			require.True(t, ok)
+			assert.Equal(t, hostB, host)
+		})
+	})
+}
+
 func TestGetClusterUsingDifferentKey(t *testing.T) {
 	// given
 	defer resetClusterCache()
@@ -390,6 +666,120 @@ func TestRefreshCache(t *testing.T) {
 	})
 }
 
+func TestRefreshIsSingleFlight(t *testing.T) {
+	// given
+	cache := NewClusterCache()
+	var calls int32
+	release := make(chan struct{})
+	cache.refreshCache = func() {
+		atomic.AddInt32(&calls, 1)
+		<-release
+	}
+	var waitForFinished sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		waitForFinished.Add(1)
+		go func() {
+			defer waitForFinished.Done()
+			_, ok := cache.GetCachedToolchainCluster("unknown")
+			assert.False(t, ok)
+		}()
+	}
+
+	// when
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&calls) == 1
+	}, 5*time.Second, time.Millisecond)
+	close(release)
+	waitForFinished.Wait()
+
+	// then
+	// the lookups that missed before the first refresh started were all served by it,
+	// the ones that missed while it was running were coalesced into at most one more
+	assert.LessOrEqual(t, atomic.LoadInt32(&calls), int32(2))
+}
+
+func TestNegativeCache(t *testing.T) {
+	// given
+	member := newTestCachedToolchainCluster(t, "member", Member, ready)
+
+	t.Run("without TTL every miss refreshes the cache", func(t *testing.T) {
+		// given
+		cache := NewClusterCache()
+		calls := 0
+		cache.refreshCache = func() {
+			calls++
+		}
+
+		// when
+		for i := 0; i < 3; i++ {
+			_, ok := cache.GetCachedToolchainCluster("unknown")
+			assert.False(t, ok)
+		}
+
+		// then
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("with TTL the miss is remembered", func(t *testing.T) {
+		// given
+		cache := NewClusterCache(WithNegativeCacheTTL(time.Hour))
+		calls := 0
+		cache.refreshCache = func() {
+			calls++
+		}
+
+		// when
+		for i := 0; i < 3; i++ {
+			_, ok := cache.GetCachedToolchainCluster("member")
+			assert.False(t, ok)
+		}
+
+		// then
+		assert.Equal(t, 1, calls)
+
+		t.Run("until the cluster is added", func(t *testing.T) {
+			// when
+			cache.addCachedToolchainCluster(member)
+
+			// then
+			returned, ok := cache.GetCachedToolchainCluster("member")
+			assert.True(t, ok)
+			assert.Equal(t, member, returned)
+		})
+
+		t.Run("it is forgotten once the cluster is added", func(t *testing.T) {
+			// given
+			cache.deleteCachedToolchainCluster("member")
+
+			// when
+			_, ok := cache.GetCachedToolchainCluster("member")
+
+			// then
+			assert.False(t, ok)
+			assert.Equal(t, 2, calls)
+		})
+	})
+
+	t.Run("with expired TTL the cache is refreshed again", func(t *testing.T) {
+		// given
+		cache := NewClusterCache(WithNegativeCacheTTL(time.Millisecond))
+		calls := 0
+		cache.refreshCache = func() {
+			calls++
+		}
+		_, ok := cache.GetCachedToolchainCluster("unknown")
+		require.False(t, ok)
+		time.Sleep(5 * time.Millisecond)
+
+		// when
+		_, ok = cache.GetCachedToolchainCluster("unknown")
+
+		// then
+		assert.False(t, ok)
+		assert.Equal(t, 2, calls)
+	})
+}
+
 func TestMultipleActionsInParallel(t *testing.T) {
 	// given
 	defer resetClusterCache()
@@ -474,6 +864,18 @@ var notReady clusterOption = func(c *CachedToolchainCluster) {
 	})
 }
 
+// withRoles an option to set the cluster-role labels of the cluster
+func withRoles(roles ...Role) clusterOption {
+	return func(c *CachedToolchainCluster) {
+		if c.Labels == nil {
+			c.Labels = map[string]string{}
+		}
+		for _, role := range roles {
+			c.Labels[RoleLabel(role)] = ""
+		}
+	}
+}
+
 func newTestCachedToolchainCluster(t *testing.T, name string, clusterType Type, options ...clusterOption) *CachedToolchainCluster {
 	cl := test.NewFakeClient(t)
 	cachedCluster := &CachedToolchainCluster{
@@ -492,5 +894,5 @@ func newTestCachedToolchainCluster(t *testing.T, name string, clusterType Type,
 }
 
 func resetClusterCache() {
-	clusterCache = toolchainClusterClients{clusters: map[string]*CachedToolchainCluster{}}
+	clusterCache = NewClusterCache()
 }
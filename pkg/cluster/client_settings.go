@@ -0,0 +1,126 @@
+package cluster
+
+import (
+	"strconv"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+)
+
+const (
+	// QPSAnnotationKey is the key of the ToolchainCluster annotation overriding the QPS of the client of the cluster
+	QPSAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "api-qps"
+	// BurstAnnotationKey is the key of the ToolchainCluster annotation overriding the burst of the client of the cluster
+	BurstAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "api-burst"
+	// TimeoutAnnotationKey is the key of the ToolchainCluster annotation overriding the timeout of the client of the cluster (eg. "5s")
+	TimeoutAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "api-timeout"
+	// UserAgentAnnotationKey is the key of the ToolchainCluster annotation overriding the user agent of the client of the cluster
+	UserAgentAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "user-agent"
+)
+
+// ClientSettings contains the settings of the client of a remote cluster
+type ClientSettings struct {
+	// QPS is the maximum queries per second sent to the cluster
+	QPS float32
+	// Burst is the maximum burst of the queries sent to the cluster
+	Burst int
+	// Timeout is the timeout of a single request sent to the cluster. Zero means no timeout.
+	Timeout time.Duration
+	// UserAgent is the user agent of the client. Empty means the default user agent of client-go.
+	UserAgent string
+}
+
+// DefaultClientSettings returns the settings used for the clusters that don't override them
+func DefaultClientSettings(timeout time.Duration) ClientSettings {
+	return ClientSettings{
+		QPS:     toolchainAPIQPS,
+		Burst:   toolchainAPIBurst,
+		Timeout: timeout,
+	}
+}
+
+// withDefaults returns a copy of the settings where the unset values are taken from the given defaults
+func (s ClientSettings) withDefaults(defaults ClientSettings) ClientSettings {
+	if s.QPS == 0 {
+		s.QPS = defaults.QPS
+	}
+	if s.Burst == 0 {
+		s.Burst = defaults.Burst
+	}
+	if s.Timeout == 0 {
+		s.Timeout = defaults.Timeout
+	}
+	if s.UserAgent == "" {
+		s.UserAgent = defaults.UserAgent
+	}
+	return s
+}
+
+// clientSettingAnnotation is an annotation of a ToolchainCluster overriding one of the client settings
+type clientSettingAnnotation struct {
+	key         string
+	requirement string
+	// apply sets the given value of the annotation in the settings. Returns false if the value is not valid.
+	apply func(settings *ClientSettings, value string) bool
+}
+
+var clientSettingAnnotations = []clientSettingAnnotation{
+	{
+		key:         QPSAnnotationKey,
+		requirement: "a positive number",
+		apply: func(settings *ClientSettings, value string) bool {
+			qps, err := strconv.ParseFloat(value, 32)
+			if err != nil || qps <= 0 {
+				return false
+			}
+			settings.QPS = float32(qps)
+			return true
+		},
+	},
+	{
+		key:         BurstAnnotationKey,
+		requirement: "a positive integer",
+		apply: func(settings *ClientSettings, value string) bool {
+			burst, err := strconv.Atoi(value)
+			if err != nil || burst <= 0 {
+				return false
+			}
+			settings.Burst = burst
+			return true
+		},
+	},
+	{
+		key:         TimeoutAnnotationKey,
+		requirement: "a non-negative duration",
+		apply: func(settings *ClientSettings, value string) bool {
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout < 0 {
+				return false
+			}
+			settings.Timeout = timeout
+			return true
+		},
+	},
+	{
+		key: UserAgentAnnotationKey,
+		apply: func(settings *ClientSettings, value string) bool {
+			if value != "" {
+				settings.UserAgent = value
+			}
+			return true
+		},
+	},
+}
+
+// clientSettingsFor returns the client settings of the given ToolchainCluster - the valid values set in its annotations
+// take precedence over the given defaults. The invalid values are ignored (so the defaults are used instead), they are
+// reported by the validation of the ToolchainCluster in its ConfigurationValid condition.
+func clientSettingsFor(toolchainCluster *toolchainv1alpha1.ToolchainCluster, defaults ClientSettings) ClientSettings {
+	settings := defaults
+	for _, annotation := range clientSettingAnnotations {
+		if value, found := toolchainCluster.Annotations[annotation.key]; found {
+			annotation.apply(&settings, value)
+		}
+	}
+	return settings
+}
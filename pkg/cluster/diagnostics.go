@@ -0,0 +1,336 @@
+package cluster
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/pkg/errors"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DiagnosticStage is a stage of the diagnostics of the connection to a cluster
+type DiagnosticStage string
+
+// The stages of the diagnostics in the order they are executed
+const (
+	TCPConnectStage        DiagnosticStage = "TCPConnect"
+	TLSHandshakeStage      DiagnosticStage = "TLSHandshake"
+	HealthzStage           DiagnosticStage = "Healthz"
+	VersionStage           DiagnosticStage = "Version"
+	PermissionsStage       DiagnosticStage = "Permissions"
+	OperatorNamespaceStage DiagnosticStage = "OperatorNamespace"
+)
+
+// certificateExpiryWarningPeriod is the period before the expiration of the serving certificate of the cluster
+// when the TLS handshake stage reports a warning
+const certificateExpiryWarningPeriod = 30 * 24 * time.Hour
+
+// ProbeResult is the result of a single stage of the diagnostics
+type ProbeResult struct {
+	Stage DiagnosticStage
+	// Success is true when the probe passed
+	Success bool
+	// Skipped is true when the probe wasn't executed because one of the previous stages failed
+	Skipped bool
+	// Message describes the result of the probe, eg. the reason of the failure
+	Message string
+	// Warnings contains the problems that don't make the probe fail, eg. the certificate that is about to expire
+	Warnings []string
+	// Duration is the time the probe took
+	Duration time.Duration
+}
+
+// DiagnosticReport is the result of the diagnostics of the connection to a cluster
+type DiagnosticReport struct {
+	ClusterName string
+	// Probes contains the results of all the stages in the order they were executed
+	Probes []ProbeResult
+	// CertificateExpiry is the expiration time of the serving certificate of the cluster (nil when TLS isn't used or the handshake failed)
+	CertificateExpiry *time.Time
+	// ServerVersion is the git version of the cluster (empty when it couldn't be retrieved)
+	ServerVersion string
+}
+
+// Healthy returns true if all the probes passed
+func (r *DiagnosticReport) Healthy() bool {
+	for _, probe := range r.Probes {
+		if !probe.Success {
+			return false
+		}
+	}
+	return true
+}
+
+// FirstFailure returns the result of the first probe that failed and info if there was any such probe
+func (r *DiagnosticReport) FirstFailure() (ProbeResult, bool) {
+	for _, probe := range r.Probes {
+		if !probe.Success && !probe.Skipped {
+			return probe, true
+		}
+	}
+	return ProbeResult{}, false
+}
+
+// Summary returns a one-line summary of the report that is suitable for a status message
+func (r *DiagnosticReport) Summary() string {
+	if failure, failed := r.FirstFailure(); failed {
+		return fmt.Sprintf("%s failed: %s", failure.Stage, failure.Message)
+	}
+	var warnings []string
+	for _, probe := range r.Probes {
+		for _, warning := range probe.Warnings {
+			warnings = append(warnings, fmt.Sprintf("%s: %s", probe.Stage, warning))
+		}
+	}
+	if len(warnings) > 0 {
+		return "all probes passed with warnings: " + strings.Join(warnings, "; ")
+	}
+	return "all probes passed"
+}
+
+// DiagnoseOption is an option of the diagnostics
+type DiagnoseOption func(*diagnostics)
+
+// WithRequiredPermissions sets the permissions that are verified in the Permissions stage.
+// If a namespace of the attributes is empty, then the operator namespace of the cluster is used.
+func WithRequiredPermissions(permissions ...authorizationv1.ResourceAttributes) DiagnoseOption {
+	return func(d *diagnostics) {
+		d.permissions = permissions
+	}
+}
+
+// DefaultRequiredPermissions returns the permissions the operators need in the operator namespace of the remote cluster
+func DefaultRequiredPermissions() []authorizationv1.ResourceAttributes {
+	var permissions []authorizationv1.ResourceAttributes
+	for _, verb := range []string{"get", "list", "watch"} {
+		permissions = append(permissions, authorizationv1.ResourceAttributes{
+			Verb:     verb,
+			Group:    toolchainv1alpha1.GroupVersion.Group,
+			Resource: "toolchainclusters",
+		})
+	}
+	return permissions
+}
+
+type diagnostics struct {
+	cluster     *CachedToolchainCluster
+	permissions []authorizationv1.ResourceAttributes
+	clientset   kubernetes.Interface
+	report      *DiagnosticReport
+}
+
+// Diagnose runs staged probes of the connection to the given cluster: TCP connection, TLS handshake (including the expiration
+// of the serving certificate), /healthz, /version, the permissions of the operator (using SelfSubjectAccessReviews) and a read
+// in the operator namespace. When a stage fails, then all the following stages are skipped, so the first failure in the report
+// points to the actual cause of the problem (eg. DNS, TLS, authentication or RBAC).
+func Diagnose(ctx context.Context, cluster *CachedToolchainCluster, options ...DiagnoseOption) *DiagnosticReport {
+	d := &diagnostics{
+		cluster:     cluster,
+		permissions: DefaultRequiredPermissions(),
+		report: &DiagnosticReport{
+			ClusterName: cluster.Name,
+		},
+	}
+	for _, apply := range options {
+		apply(d)
+	}
+
+	probes := []struct {
+		stage DiagnosticStage
+		probe func(ctx context.Context) (string, []string, error)
+	}{
+		{TCPConnectStage, d.tcpConnect},
+		{TLSHandshakeStage, d.tlsHandshake},
+		{HealthzStage, d.healthz},
+		{VersionStage, d.version},
+		{PermissionsStage, d.permissionsGranted},
+		{OperatorNamespaceStage, d.operatorNamespace},
+	}
+	var failed DiagnosticStage
+	for _, p := range probes {
+		if failed != "" {
+			d.report.Probes = append(d.report.Probes, ProbeResult{
+				Stage:   p.stage,
+				Skipped: true,
+				Message: fmt.Sprintf("skipped because the %s stage failed", failed),
+			})
+			continue
+		}
+		start := time.Now()
+		message, warnings, err := p.probe(ctx)
+		result := ProbeResult{
+			Stage:    p.stage,
+			Success:  err == nil,
+			Message:  message,
+			Warnings: warnings,
+			Duration: time.Since(start),
+		}
+		if err != nil {
+			result.Message = err.Error()
+			failed = p.stage
+		}
+		d.report.Probes = append(d.report.Probes, result)
+	}
+	return d.report
+}
+
+func (d *diagnostics) endpoint() (*url.URL, string, error) {
+	if d.cluster.RestConfig == nil {
+		return nil, "", errors.New("the cluster has no REST config")
+	}
+	endpoint, err := url.Parse(d.cluster.RestConfig.Host)
+	if err != nil || endpoint.Host == "" {
+		// the host may be set without a scheme
+		endpoint, err = url.Parse("https://" + d.cluster.RestConfig.Host)
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "invalid API endpoint %q", d.cluster.RestConfig.Host)
+		}
+	}
+	port := endpoint.Port()
+	if port == "" {
+		port = "443"
+		if endpoint.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return endpoint, net.JoinHostPort(endpoint.Hostname(), port), nil
+}
+
+func (d *diagnostics) tcpConnect(ctx context.Context) (string, []string, error) {
+	_, address, err := d.endpoint()
+	if err != nil {
+		return "", nil, err
+	}
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "unable to connect to %s", address)
+	}
+	defer conn.Close()
+	return fmt.Sprintf("connected to %s", conn.RemoteAddr()), nil, nil
+}
+
+func (d *diagnostics) tlsHandshake(ctx context.Context) (string, []string, error) {
+	endpoint, address, err := d.endpoint()
+	if err != nil {
+		return "", nil, err
+	}
+	if endpoint.Scheme == "http" {
+		return "the API endpoint doesn't use TLS", []string{"the connection to the cluster is not encrypted"}, nil
+	}
+	tlsConfig, err := rest.TLSConfigFor(d.cluster.RestConfig)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "invalid TLS configuration")
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{} // nolint:gosec
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = endpoint.Hostname()
+	}
+	dialer := &tls.Dialer{Config: tlsConfig}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "TLS handshake with %s failed", address)
+	}
+	defer conn.Close()
+
+	var warnings []string
+	if tlsConfig.InsecureSkipVerify {
+		warnings = append(warnings, "the TLS validations are disabled")
+	}
+	state := conn.(*tls.Conn).ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return "TLS handshake succeeded", warnings, nil
+	}
+	expiry := state.PeerCertificates[0].NotAfter
+	d.report.CertificateExpiry = &expiry
+	remaining := time.Until(expiry)
+	if remaining <= 0 {
+		return "", warnings, errors.Errorf("the serving certificate expired at %s", expiry.UTC().Format(time.RFC3339))
+	}
+	if remaining < certificateExpiryWarningPeriod {
+		warnings = append(warnings, fmt.Sprintf("the serving certificate expires at %s", expiry.UTC().Format(time.RFC3339)))
+	}
+	return fmt.Sprintf("TLS handshake succeeded, the serving certificate expires at %s", expiry.UTC().Format(time.RFC3339)), warnings, nil
+}
+
+func (d *diagnostics) healthz(ctx context.Context) (string, []string, error) {
+	clientset, err := kubernetes.NewForConfig(d.cluster.RestConfig)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "unable to create the clientset")
+	}
+	d.clientset = clientset
+	body, err := clientset.Discovery().RESTClient().Get().AbsPath("/healthz").Do(ctx).Raw()
+	if err != nil {
+		return "", nil, errors.Wrap(err, "/healthz request failed")
+	}
+	if !strings.EqualFold(string(body), "ok") {
+		return "", nil, errors.Errorf("/healthz responded with %q", string(body))
+	}
+	return "/healthz responded with ok", nil, nil
+}
+
+func (d *diagnostics) version(_ context.Context) (string, []string, error) {
+	version, err := d.clientset.Discovery().ServerVersion()
+	if err != nil {
+		return "", nil, errors.Wrap(err, "/version request failed")
+	}
+	d.report.ServerVersion = version.GitVersion
+	return fmt.Sprintf("the cluster runs version %s", version.GitVersion), nil, nil
+}
+
+func (d *diagnostics) permissionsGranted(ctx context.Context) (string, []string, error) {
+	var denied []string
+	for _, permission := range d.permissions {
+		attributes := permission
+		if attributes.Namespace == "" {
+			attributes.Namespace = d.cluster.OperatorNamespace
+		}
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &attributes,
+			},
+		}
+		review, err := d.clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		if err != nil {
+			return "", nil, errors.Wrap(err, "unable to create SelfSubjectAccessReview")
+		}
+		if !review.Status.Allowed {
+			denied = append(denied, describePermission(attributes))
+		}
+	}
+	if len(denied) > 0 {
+		return "", nil, errors.Errorf("missing permissions: %s", strings.Join(denied, ", "))
+	}
+	return fmt.Sprintf("all %d required permissions are granted", len(d.permissions)), nil, nil
+}
+
+func describePermission(attributes authorizationv1.ResourceAttributes) string {
+	resource := attributes.Resource
+	if attributes.Group != "" {
+		resource += "." + attributes.Group
+	}
+	return fmt.Sprintf("%s %s in namespace %s", attributes.Verb, resource, attributes.Namespace)
+}
+
+func (d *diagnostics) operatorNamespace(ctx context.Context) (string, []string, error) {
+	if d.cluster.Client == nil {
+		return "", nil, errors.New("the cluster has no client")
+	}
+	toolchainClusters := &toolchainv1alpha1.ToolchainClusterList{}
+	if err := d.cluster.Client.List(ctx, toolchainClusters, client.InNamespace(d.cluster.OperatorNamespace), client.Limit(1)); err != nil {
+		return "", nil, errors.Wrapf(err, "unable to read ToolchainClusters in namespace %s", d.cluster.OperatorNamespace)
+	}
+	return fmt.Sprintf("ToolchainClusters in namespace %s can be read", d.cluster.OperatorNamespace), nil, nil
+}
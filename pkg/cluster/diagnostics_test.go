@@ -0,0 +1,198 @@
+package cluster_test
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/codeready-toolchain/toolchain-common/pkg/cluster"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestDiagnose(t *testing.T) {
+	// given
+	healthz := "ok"
+	deniedVerbs := map[string]bool{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/healthz":
+			_, _ = w.Write([]byte(healthz))
+		case "/version":
+			_, _ = w.Write([]byte(`{"major":"1","minor":"25","gitVersion":"v1.25.0"}`))
+		case "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews":
+			review := &authorizationv1.SelfSubjectAccessReview{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(review))
+			review.Status.Allowed = !deniedVerbs[review.Spec.ResourceAttributes.Verb]
+			w.WriteHeader(http.StatusCreated)
+			assert.NoError(t, json.NewEncoder(w).Encode(review))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	caData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	newCachedCluster := func(t *testing.T, host string, caData []byte) (*cluster.CachedToolchainCluster, *test.FakeClient) {
+		cl := test.NewFakeClient(t)
+		return &cluster.CachedToolchainCluster{
+			Config: &cluster.Config{
+				Name:              "east",
+				OperatorNamespace: "toolchain-member-operator",
+				RestConfig: &rest.Config{
+					Host:            host,
+					BearerToken:     "mycooltoken",
+					TLSClientConfig: rest.TLSClientConfig{CAData: caData},
+				},
+			},
+			Client: cl,
+		}, cl
+	}
+
+	assertStages := func(t *testing.T, report *cluster.DiagnosticReport, passed int, failure cluster.DiagnosticStage) {
+		require.Len(t, report.Probes, 6)
+		for i, probe := range report.Probes {
+			switch {
+			case i < passed:
+				assert.True(t, probe.Success, "stage %s should pass: %s", probe.Stage, probe.Message)
+			case i == passed:
+				assert.Equal(t, failure, probe.Stage)
+				assert.False(t, probe.Success)
+				assert.False(t, probe.Skipped)
+			default:
+				assert.True(t, probe.Skipped, "stage %s should be skipped", probe.Stage)
+				assert.Equal(t, fmt.Sprintf("skipped because the %s stage failed", failure), probe.Message)
+			}
+		}
+		assert.False(t, report.Healthy())
+	}
+
+	t.Run("all probes pass", func(t *testing.T) {
+		// given
+		cachedCluster, _ := newCachedCluster(t, server.URL, caData)
+
+		// when
+		report := cluster.Diagnose(context.TODO(), cachedCluster)
+
+		// then
+		assert.True(t, report.Healthy())
+		assert.Equal(t, "east", report.ClusterName)
+		assert.Equal(t, "all probes passed", report.Summary())
+		assert.Equal(t, "v1.25.0", report.ServerVersion)
+		require.NotNil(t, report.CertificateExpiry)
+		assert.Equal(t, server.Certificate().NotAfter, *report.CertificateExpiry)
+		stages := make([]cluster.DiagnosticStage, len(report.Probes))
+		for i, probe := range report.Probes {
+			stages[i] = probe.Stage
+		}
+		assert.Equal(t, []cluster.DiagnosticStage{cluster.TCPConnectStage, cluster.TLSHandshakeStage, cluster.HealthzStage,
+			cluster.VersionStage, cluster.PermissionsStage, cluster.OperatorNamespaceStage}, stages)
+	})
+
+	t.Run("TCP connection fails", func(t *testing.T) {
+		// given
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+		cachedCluster, _ := newCachedCluster(t, closed.URL, nil)
+
+		// when
+		report := cluster.Diagnose(context.TODO(), cachedCluster)
+
+		// then
+		assertStages(t, report, 0, cluster.TCPConnectStage)
+		assert.Contains(t, report.Summary(), "TCPConnect failed: unable to connect to "+closed.Listener.Addr().String())
+	})
+
+	t.Run("TLS handshake fails because of unknown CA", func(t *testing.T) {
+		// given
+		cachedCluster, _ := newCachedCluster(t, server.URL, nil)
+
+		// when
+		report := cluster.Diagnose(context.TODO(), cachedCluster)
+
+		// then
+		assertStages(t, report, 1, cluster.TLSHandshakeStage)
+		assert.Contains(t, report.Summary(), "certificate signed by unknown authority")
+		assert.Nil(t, report.CertificateExpiry)
+	})
+
+	t.Run("insecure connection passes with warning", func(t *testing.T) {
+		// given
+		cachedCluster, _ := newCachedCluster(t, server.URL, nil)
+		cachedCluster.RestConfig.Insecure = true
+
+		// when
+		report := cluster.Diagnose(context.TODO(), cachedCluster)
+
+		// then
+		assert.True(t, report.Healthy())
+		assert.Equal(t, "all probes passed with warnings: TLSHandshake: the TLS validations are disabled", report.Summary())
+	})
+
+	t.Run("healthz is not ok", func(t *testing.T) {
+		// given
+		healthz = "unstable"
+		defer func() { healthz = "ok" }()
+		cachedCluster, _ := newCachedCluster(t, server.URL, caData)
+
+		// when
+		report := cluster.Diagnose(context.TODO(), cachedCluster)
+
+		// then
+		assertStages(t, report, 2, cluster.HealthzStage)
+		assert.Equal(t, `Healthz failed: /healthz responded with "unstable"`, report.Summary())
+	})
+
+	t.Run("permissions are missing", func(t *testing.T) {
+		// given
+		deniedVerbs["watch"] = true
+		defer delete(deniedVerbs, "watch")
+		cachedCluster, _ := newCachedCluster(t, server.URL, caData)
+
+		// when
+		report := cluster.Diagnose(context.TODO(), cachedCluster)
+
+		// then
+		assertStages(t, report, 4, cluster.PermissionsStage)
+		assert.Equal(t, "Permissions failed: missing permissions: watch toolchainclusters.toolchain.dev.openshift.com in namespace toolchain-member-operator", report.Summary())
+	})
+
+	t.Run("custom permissions", func(t *testing.T) {
+		// given
+		deniedVerbs["delete"] = true
+		defer delete(deniedVerbs, "delete")
+		cachedCluster, _ := newCachedCluster(t, server.URL, caData)
+
+		// when
+		report := cluster.Diagnose(context.TODO(), cachedCluster, cluster.WithRequiredPermissions(
+			authorizationv1.ResourceAttributes{Verb: "delete", Resource: "secrets", Namespace: "other"}))
+
+		// then
+		assertStages(t, report, 4, cluster.PermissionsStage)
+		assert.Equal(t, "Permissions failed: missing permissions: delete secrets in namespace other", report.Summary())
+	})
+
+	t.Run("operator namespace cannot be read", func(t *testing.T) {
+		// given
+		cachedCluster, cl := newCachedCluster(t, server.URL, caData)
+		cl.MockList = func(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+			return fmt.Errorf("some error")
+		}
+
+		// when
+		report := cluster.Diagnose(context.TODO(), cachedCluster)
+
+		// then
+		assertStages(t, report, 5, cluster.OperatorNamespaceStage)
+		assert.Equal(t, "OperatorNamespace failed: unable to read ToolchainClusters in namespace toolchain-member-operator: some error", report.Summary())
+	})
+}
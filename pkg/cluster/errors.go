@@ -0,0 +1,53 @@
+package cluster
+
+import (
+	"github.com/pkg/errors"
+)
+
+// The reasons of the failures of the construction of the client of a ToolchainCluster caused by its configuration
+const (
+	InvalidAPIEndpointReason   = "InvalidAPIEndpoint"
+	SecretNotFoundReason       = "SecretNotFound"
+	InvalidCredentialsReason   = "InvalidCredentials"
+	InvalidCABundleReason      = "InvalidCABundle"
+	ClientCreationFailedReason = "ClientCreationFailed"
+)
+
+// ConfigurationError is an error caused by the configuration of a ToolchainCluster (or of its Secret)
+// that prevents the construction of the client of the cluster
+type ConfigurationError struct {
+	// Reason is a CamelCase reason of the failure, eg. InvalidCABundle
+	Reason string
+	err    error
+}
+
+func newConfigurationError(reason string, err error) error {
+	return &ConfigurationError{
+		Reason: reason,
+		err:    err,
+	}
+}
+
+func (e *ConfigurationError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *ConfigurationError) Unwrap() error {
+	return e.err
+}
+
+// Cause returns the underlying error (see github.com/pkg/errors)
+func (e *ConfigurationError) Cause() error {
+	return e.err
+}
+
+// ConfigurationErrorReason returns the reason of the ConfigurationError contained in the chain of the given error,
+// or an empty string if the error wasn't caused by the configuration of the cluster
+func ConfigurationErrorReason(err error) string {
+	var configErr *ConfigurationError
+	if errors.As(err, &configErr) {
+		return configErr.Reason
+	}
+	return ""
+}
@@ -0,0 +1,147 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// EventType is a type of the change of a CachedToolchainCluster in the cache
+type EventType string
+
+const (
+	// ClusterAdded is sent when a cluster that wasn't in the cache before is added
+	ClusterAdded EventType = "Added"
+	// ClusterUpdated is sent when an already cached cluster is replaced, but its readiness hasn't changed
+	ClusterUpdated EventType = "Updated"
+	// ClusterRemoved is sent when a cluster is removed from the cache
+	ClusterRemoved EventType = "Removed"
+	// ClusterReadinessChanged is sent when an already cached cluster is replaced and its readiness has changed
+	ClusterReadinessChanged EventType = "ReadinessChanged"
+)
+
+// eventsBufferSize is the size of the buffer of the channels returned by ClusterCache.Subscribe
+const eventsBufferSize = 100
+
+// Event describes a change of a CachedToolchainCluster in the cache.
+// Old is nil for ClusterAdded events, New is nil for ClusterRemoved events.
+type Event struct {
+	Type EventType
+	Old  *CachedToolchainCluster
+	New  *CachedToolchainCluster
+}
+
+// Name returns the name of the cluster the event is related to
+func (e Event) Name() string {
+	if e.New != nil {
+		return e.New.Name
+	}
+	return e.Old.Name
+}
+
+var eventsLog = logf.Log.WithName("toolchaincluster_cache_events")
+
+type subscription struct {
+	events chan Event
+}
+
+type subscriptions struct {
+	sync.RWMutex
+	subs map[*subscription]struct{}
+}
+
+// Subscribe registers a new subscriber of the cache changes and returns the channel the events are sent to,
+// along with a function that cancels the subscription. The subscriber is expected to keep reading the events
+// until the subscription is cancelled - the changes of the cache are never blocked by the subscribers, so when the buffer
+// of a subscriber is full, then the events are dropped for that subscriber (and it should read the current state from the cache).
+// The returned channel is never closed.
+func (c *ClusterCache) Subscribe() (<-chan Event, func()) {
+	sub := &subscription{
+		events: make(chan Event, eventsBufferSize),
+	}
+	c.subscriptions.Lock()
+	defer c.subscriptions.Unlock()
+	if c.subscriptions.subs == nil {
+		c.subscriptions.subs = map[*subscription]struct{}{}
+	}
+	c.subscriptions.subs[sub] = struct{}{}
+
+	return sub.events, func() {
+		c.subscriptions.Lock()
+		defer c.subscriptions.Unlock()
+		delete(c.subscriptions.subs, sub)
+	}
+}
+
+// ChannelSource returns a controller-runtime source that emits a GenericEvent for every change of the cache,
+// so a controller can requeue when the cluster topology changes. The object of the GenericEvent is a ToolchainCluster
+// containing the name, namespace and labels of the changed cluster. The subscription is cancelled when the given context is done.
+func (c *ClusterCache) ChannelSource(ctx context.Context) source.Source {
+	events, unsubscribe := c.Subscribe()
+	genericEvents := make(chan event.GenericEvent)
+	go func() {
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-events:
+				select {
+				case <-ctx.Done():
+					return
+				case genericEvents <- event.GenericEvent{Object: toToolchainCluster(e)}:
+				}
+			}
+		}
+	}()
+	return &source.Channel{Source: genericEvents}
+}
+
+func toToolchainCluster(e Event) *toolchainv1alpha1.ToolchainCluster {
+	toolchainCluster := &toolchainv1alpha1.ToolchainCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: e.Name(),
+		},
+	}
+	if e.New != nil && e.New.Config != nil {
+		toolchainCluster.Namespace = e.New.Namespace
+		toolchainCluster.Labels = e.New.Labels
+	} else if e.Old != nil && e.Old.Config != nil {
+		toolchainCluster.Namespace = e.Old.Namespace
+		toolchainCluster.Labels = e.Old.Labels
+	}
+	return toolchainCluster
+}
+
+func (c *ClusterCache) notify(e Event) {
+	c.subscriptions.RLock()
+	defer c.subscriptions.RUnlock()
+	for sub := range c.subscriptions.subs {
+		// never block the changes of the cache by a slow subscriber
+		select {
+		case sub.events <- e:
+		default:
+			eventsLog.Info("dropping the event because the buffer of the subscriber is full", "type", e.Type, "cluster", e.Name())
+		}
+	}
+}
+
+func newAddOrUpdateEvent(old, new *CachedToolchainCluster) Event {
+	switch {
+	case old == nil:
+		return Event{Type: ClusterAdded, New: new}
+	case isClusterReady(old) != isClusterReady(new):
+		return Event{Type: ClusterReadinessChanged, Old: old, New: new}
+	default:
+		return Event{Type: ClusterUpdated, Old: old, New: new}
+	}
+}
+
+func isClusterReady(cluster *CachedToolchainCluster) bool {
+	return cluster.ClusterStatus != nil && IsReady(cluster.ClusterStatus)
+}
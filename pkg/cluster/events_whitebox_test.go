@@ -0,0 +1,152 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+func TestSubscribe(t *testing.T) {
+	// given
+	cache := NewClusterCache()
+	events, unsubscribe := cache.Subscribe()
+	defer unsubscribe()
+	member := newTestCachedToolchainCluster(t, "member", Member, ready)
+	updatedMember := newTestCachedToolchainCluster(t, "member", Member, ready)
+	notReadyMember := newTestCachedToolchainCluster(t, "member", Member, notReady)
+
+	t.Run("added", func(t *testing.T) {
+		// when
+		cache.addCachedToolchainCluster(member)
+
+		// then
+		assertEvent(t, events, Event{Type: ClusterAdded, New: member})
+	})
+
+	t.Run("updated", func(t *testing.T) {
+		// when
+		cache.addCachedToolchainCluster(updatedMember)
+
+		// then
+		assertEvent(t, events, Event{Type: ClusterUpdated, Old: member, New: updatedMember})
+	})
+
+	t.Run("readiness changed", func(t *testing.T) {
+		// when
+		cache.addCachedToolchainCluster(notReadyMember)
+
+		// then
+		assertEvent(t, events, Event{Type: ClusterReadinessChanged, Old: updatedMember, New: notReadyMember})
+	})
+
+	t.Run("removed", func(t *testing.T) {
+		// when
+		cache.deleteCachedToolchainCluster("member")
+
+		// then
+		assertEvent(t, events, Event{Type: ClusterRemoved, Old: notReadyMember})
+	})
+
+	t.Run("no event when removing unknown cluster", func(t *testing.T) {
+		// when
+		cache.deleteCachedToolchainCluster("unknown")
+
+		// then
+		assertNoEvent(t, events)
+	})
+}
+
+func TestUnsubscribe(t *testing.T) {
+	// given
+	cache := NewClusterCache()
+	events, unsubscribe := cache.Subscribe()
+	otherEvents, otherUnsubscribe := cache.Subscribe()
+	defer otherUnsubscribe()
+	member := newTestCachedToolchainCluster(t, "member", Member, ready)
+
+	// when
+	unsubscribe()
+	unsubscribe() // can be called multiple times
+	cache.addCachedToolchainCluster(member)
+
+	// then
+	assertNoEvent(t, events)
+	assertEvent(t, otherEvents, Event{Type: ClusterAdded, New: member})
+}
+
+func TestEventsAreDroppedWhenBufferIsFull(t *testing.T) {
+	// given
+	cache := NewClusterCache()
+	events, unsubscribe := cache.Subscribe()
+	defer unsubscribe()
+	for i := 0; i < eventsBufferSize; i++ {
+		cache.addCachedToolchainCluster(newTestCachedToolchainCluster(t, "member", Member, ready))
+	}
+	added := make(chan struct{})
+
+	// when
+	go func() {
+		cache.addCachedToolchainCluster(newTestCachedToolchainCluster(t, "member", Member, ready))
+		close(added)
+	}()
+
+	// then
+	select {
+	case <-added:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "the cache change was blocked by a full subscription")
+	}
+	assert.Len(t, events, eventsBufferSize)
+}
+
+func TestChannelSource(t *testing.T) {
+	// given
+	cache := NewClusterCache()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	src := cache.ChannelSource(ctx)
+	channelSource, ok := src.(*source.Channel)
+	require.True(t, ok)
+	member := newTestCachedToolchainCluster(t, "member", Member, ready)
+	member.Labels = map[string]string{RoleLabel(Tenant): ""}
+	member.Namespace = "toolchain-host-operator"
+
+	// when
+	cache.addCachedToolchainCluster(member)
+
+	// then
+	select {
+	case e := <-channelSource.Source:
+		toolchainCluster, ok := e.Object.(*toolchainv1alpha1.ToolchainCluster)
+		require.True(t, ok)
+		assert.Equal(t, "member", toolchainCluster.Name)
+		assert.Equal(t, "toolchain-host-operator", toolchainCluster.Namespace)
+		assert.Equal(t, member.Labels, toolchainCluster.Labels)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "no generic event received")
+	}
+}
+
+func assertEvent(t *testing.T, events <-chan Event, expected Event) {
+	select {
+	case e := <-events:
+		assert.Equal(t, expected.Type, e.Type)
+		assert.Same(t, expected.Old, e.Old)
+		assert.Same(t, expected.New, e.New)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "no event received", "expected event of type %s", expected.Type)
+	}
+}
+
+func assertNoEvent(t *testing.T, events <-chan Event) {
+	select {
+	case e := <-events:
+		assert.Fail(t, "unexpected event received", "event: %+v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,78 @@
+package cluster
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	runtimecluster "sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// informerCacheSyncTimeout is the maximum time to wait for the informer cache of a newly added cluster to be started
+const informerCacheSyncTimeout = 30 * time.Second
+
+// WithInformerCache makes the service create a controller-runtime Cluster with a shared informer cache for each ToolchainCluster.
+// The client of the CachedToolchainCluster then reads from the informer cache instead of sending the requests to the cluster,
+// and the watches of the resources in the cluster can be registered via CachedToolchainCluster.Source.
+// The informer cache is started when the cluster is added to the cache and stopped when it is removed or its client is rebuilt.
+// The informer cache is scoped to the operator namespace of the cluster (see Config.OperatorNamespace), because the service accounts
+// of the ToolchainClusters usually have only namespace-scoped permissions. Hence, the client cannot read the namespaced objects
+// in any other namespace - such reads should go through the Clientset instead.
+func WithInformerCache() ServiceOption {
+	return func(service *ToolchainClusterService) {
+		service.informerCache = true
+	}
+}
+
+func (s *ToolchainClusterService) startRuntimeCluster(log logr.Logger, restConfig *rest.Config, namespace string, scheme *runtime.Scheme) (runtimecluster.Cluster, context.CancelFunc, error) {
+	newCluster := s.newCluster
+	if newCluster == nil {
+		newCluster = runtimecluster.New
+	}
+	// use a copy, so the cluster cannot change the config that is compared when the cache is refreshed
+	runtimeCluster, err := newCluster(rest.CopyConfig(restConfig), func(options *runtimecluster.Options) {
+		options.Scheme = scheme
+		options.Namespace = namespace
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	go func() {
+		if err := runtimeCluster.Start(ctx); err != nil {
+			log.Error(err, "the informer cache of the ToolchainCluster was stopped with an error")
+		}
+	}()
+	syncCtx, cancel := context.WithTimeout(ctx, informerCacheSyncTimeout)
+	defer cancel()
+	if !runtimeCluster.GetCache().WaitForCacheSync(syncCtx) {
+		stop()
+		return nil, nil, errors.New("the informer cache of the cluster was not synced")
+	}
+	return runtimeCluster, stop, nil
+}
+
+// Source returns a source of the events of the given kind of objects in the cluster, so a controller can watch them.
+// Returns an error if the cluster isn't backed by an informer cache.
+// The source is bound to the informer cache of this CachedToolchainCluster, which is stopped as soon as the client of the cluster
+// is rebuilt (eg. when its token is rotated) - the watch then silently stops receiving the events. Hence, the callers should subscribe
+// to the changes of the ClusterCache and register the watches again when they receive a ClusterUpdated or ClusterReadinessChanged
+// event whose New cluster has a different Cluster than the Old one.
+func (c *CachedToolchainCluster) Source(obj client.Object) (source.Source, error) {
+	if c.Cluster == nil {
+		return nil, errors.Errorf("the cluster %s is not backed by an informer cache", c.Name)
+	}
+	return source.NewKindWithCache(obj, c.Cluster.GetCache()), nil
+}
+
+func (c *CachedToolchainCluster) stopCluster() {
+	if c.stop != nil {
+		c.stop()
+	}
+}
@@ -0,0 +1,235 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	runtimecluster "sigs.k8s.io/controller-runtime/pkg/cluster"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestInformerCache(t *testing.T) {
+	// given
+	status := test.NewClusterStatus(toolchainv1alpha1.ToolchainClusterReady, corev1.ConditionTrue)
+	east, eastSecret := test.NewToolchainCluster("east", "secret-east", status, map[string]string{"type": string(Member)})
+
+	newService := func(t *testing.T, synced bool, options ...ServiceOption) (ToolchainClusterService, *ClusterCache, *[]*fakeRuntimeCluster) {
+		cl := test.NewFakeClient(t, east, eastSecret)
+		cache := NewClusterCache()
+		service := NewToolchainClusterServiceWithCache(cache, cl, logf.Log, "test-namespace", 0, nil, append(options, WithInformerCache())...)
+		var created []*fakeRuntimeCluster
+		service.newCluster = func(config *rest.Config, opts ...runtimecluster.Option) (runtimecluster.Cluster, error) {
+			runtimeCluster := newFakeRuntimeCluster(t, synced)
+			for _, opt := range opts {
+				opt(&runtimeCluster.options)
+			}
+			created = append(created, runtimeCluster)
+			return runtimeCluster, nil
+		}
+		return service, cache, &created
+	}
+
+	t.Run("cluster is started and its client is used", func(t *testing.T) {
+		// given
+		service, cache, created := newService(t, true)
+
+		// when
+		err := service.AddOrUpdateToolchainCluster(east)
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, *created, 1)
+		runtimeCluster := (*created)[0]
+		cachedEast, ok := cache.GetCachedToolchainCluster("east")
+		require.True(t, ok)
+		assert.Same(t, runtimeCluster, cachedEast.Cluster)
+		assert.Same(t, runtimeCluster.client, cachedEast.Client)
+		runtimeCluster.waitForStarted(t)
+		assert.Equal(t, "toolchain-member-operator", runtimeCluster.options.Namespace)
+		src, err := cachedEast.Source(&corev1.ConfigMap{})
+		require.NoError(t, err)
+		assert.NotNil(t, src)
+
+		t.Run("cluster is reused when config doesn't change", func(t *testing.T) {
+			// when
+			err := service.AddOrUpdateToolchainCluster(east)
+
+			// then
+			require.NoError(t, err)
+			require.Len(t, *created, 1)
+			assert.False(t, runtimeCluster.isStopped())
+		})
+
+		t.Run("cluster is stopped when config changes", func(t *testing.T) {
+			// given
+			cachedEast, _ := cache.GetCachedToolchainCluster("east")
+			cachedEast.RestConfig.BearerToken = "old-token"
+			events, unsubscribe := cache.Subscribe()
+			defer unsubscribe()
+
+			// when
+			err := service.AddOrUpdateToolchainCluster(east)
+
+			// then
+			require.NoError(t, err)
+			require.Len(t, *created, 2)
+			runtimeCluster.waitForStopped(t)
+			newRuntimeCluster := (*created)[1]
+			newRuntimeCluster.waitForStarted(t)
+			assert.False(t, newRuntimeCluster.isStopped())
+			// the subscribers are notified, so they can register the watches again using the source of the new cluster
+			e := <-events
+			assert.Equal(t, ClusterUpdated, e.Type)
+			assert.Same(t, runtimeCluster, e.Old.Cluster)
+			assert.Same(t, newRuntimeCluster, e.New.Cluster)
+			src, err := e.New.Source(&corev1.ConfigMap{})
+			require.NoError(t, err)
+			assert.NotNil(t, src)
+
+			t.Run("cluster is rebuilt when operator namespace changes", func(t *testing.T) {
+				// given
+				movedEast := east.DeepCopy()
+				movedEast.Labels["namespace"] = "other-namespace"
+
+				// when
+				err := service.AddOrUpdateToolchainCluster(movedEast)
+
+				// then
+				require.NoError(t, err)
+				require.Len(t, *created, 3)
+				newRuntimeCluster.waitForStopped(t)
+				assert.Equal(t, "other-namespace", (*created)[2].options.Namespace)
+			})
+
+			t.Run("cluster is stopped when deleted", func(t *testing.T) {
+				// given
+				lastRuntimeCluster := (*created)[len(*created)-1]
+
+				// when
+				service.DeleteToolchainCluster("east")
+
+				// then
+				lastRuntimeCluster.waitForStopped(t)
+			})
+		})
+	})
+
+	t.Run("fails when cache is not synced", func(t *testing.T) {
+		// given
+		service, cache, created := newService(t, false)
+
+		// when
+		err := service.AddOrUpdateToolchainCluster(east)
+
+		// then
+		require.EqualError(t, err, "the cluster was not added nor updated: cannot create ToolchainCluster client: the informer cache of the cluster was not synced")
+		require.Len(t, *created, 1)
+		(*created)[0].waitForStopped(t)
+		_, ok := cache.getCachedToolchainCluster("east", false)
+		assert.False(t, ok)
+	})
+
+	t.Run("cluster is stopped when clientset cannot be created", func(t *testing.T) {
+		// given
+		// the clientset refuses a negative burst
+		service, cache, created := newService(t, true, WithDefaultClientSettings(ClientSettings{Burst: -1}))
+
+		// when
+		err := service.AddOrUpdateToolchainCluster(east)
+
+		// then
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "cannot create ToolchainCluster clientset")
+		require.Len(t, *created, 1)
+		(*created)[0].waitForStopped(t)
+		_, ok := cache.getCachedToolchainCluster("east", false)
+		assert.False(t, ok)
+	})
+
+	t.Run("no source without informer cache", func(t *testing.T) {
+		// given
+		cachedCluster := newTestCachedToolchainCluster(t, "east", Member, ready)
+
+		// when
+		_, err := cachedCluster.Source(&corev1.ConfigMap{})
+
+		// then
+		require.EqualError(t, err, "the cluster east is not backed by an informer cache")
+	})
+}
+
+type fakeRuntimeCluster struct {
+	runtimecluster.Cluster
+	client  client.Client
+	cache   *fakeInformerCache
+	options runtimecluster.Options
+	started chan struct{}
+	stopped chan struct{}
+}
+
+func newFakeRuntimeCluster(t *testing.T, synced bool) *fakeRuntimeCluster {
+	return &fakeRuntimeCluster{
+		client:  test.NewFakeClient(t),
+		cache:   &fakeInformerCache{synced: synced},
+		started: make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+func (c *fakeRuntimeCluster) GetClient() client.Client {
+	return c.client
+}
+
+func (c *fakeRuntimeCluster) GetCache() cache.Cache {
+	return c.cache
+}
+
+func (c *fakeRuntimeCluster) Start(ctx context.Context) error {
+	close(c.started)
+	<-ctx.Done()
+	close(c.stopped)
+	return nil
+}
+
+func (c *fakeRuntimeCluster) waitForStarted(t *testing.T) {
+	select {
+	case <-c.started:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "the cluster wasn't started")
+	}
+}
+
+func (c *fakeRuntimeCluster) waitForStopped(t *testing.T) {
+	select {
+	case <-c.stopped:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "the cluster wasn't stopped")
+	}
+}
+
+func (c *fakeRuntimeCluster) isStopped() bool {
+	select {
+	case <-c.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+type fakeInformerCache struct {
+	cache.Cache
+	synced bool
+}
+
+func (c *fakeInformerCache) WaitForCacheSync(_ context.Context) bool {
+	return c.synced
+}
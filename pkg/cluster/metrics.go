@@ -0,0 +1,115 @@
+package cluster
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	metricsNamespace = "toolchain"
+	metricsSubsystem = "cluster_cache"
+
+	// refreshOperation is the value of the "operation" label of the refresh metrics when the cache is refreshed because of a cache miss
+	refreshOperation = "refresh"
+	// resyncOperation is the value of the "operation" label of the refresh metrics when the whole cache is resynced
+	resyncOperation = "resync"
+)
+
+var (
+	// cacheSizeDesc describes the number of clusters in the cache by their type and role (a cluster with more roles is counted for each of them)
+	cacheSizeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, metricsSubsystem, "clusters"),
+		"Number of the clusters in the cache by the cluster type and role",
+		[]string{"type", "role"}, nil)
+
+	// cacheRefreshCounter is the number of refreshes and resyncs of the cache
+	cacheRefreshCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "refreshes_total",
+		Help:      "Number of the refreshes of the cache by the operation (refresh on a cache miss or resync)",
+	}, []string{"operation"})
+
+	// cacheRefreshDurationHistogram is the duration of the refreshes and resyncs of the cache
+	cacheRefreshDurationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "refresh_duration_seconds",
+		Help:      "Duration of the refreshes of the cache by the operation (refresh on a cache miss or resync)",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	// clientRebuildCounter is the number of clients that were (re)created for the clusters
+	clientRebuildCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "client_rebuilds_total",
+		Help:      "Number of the clients created for the cluster because it wasn't cached yet or its config has changed",
+	}, []string{"cluster_name"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(clusterCache.SizeCollector(), cacheRefreshCounter, cacheRefreshDurationHistogram, clientRebuildCounter)
+}
+
+// SizeCollector returns a collector of the number of the clusters in the cache. The collector of the default cache
+// is registered in the controller-runtime metrics registry, the collectors of the other caches can be registered
+// in other registries (or instead of the default one).
+func (c *ClusterCache) SizeCollector() prometheus.Collector {
+	return cacheSizeCollector{cache: c}
+}
+
+// cacheSizeCollector reads the current number of clusters from the cache every time the metrics are collected,
+// so the caches never overwrite the metrics of each other
+type cacheSizeCollector struct {
+	cache *ClusterCache
+}
+
+// Describe implements prometheus.Collector
+func (c cacheSizeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheSizeDesc
+}
+
+// Collect implements prometheus.Collector
+func (c cacheSizeCollector) Collect(ch chan<- prometheus.Metric) {
+	for labels, size := range c.cache.sizes() {
+		ch <- prometheus.MustNewConstMetric(cacheSizeDesc, prometheus.GaugeValue, size, labels[0], labels[1])
+	}
+}
+
+// observeRefresh records the refresh of the cache that started at the given time
+func observeRefresh(operation string, start time.Time) {
+	cacheRefreshCounter.WithLabelValues(operation).Inc()
+	cacheRefreshDurationHistogram.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// sizes returns the number of the clusters that are currently in the cache by their type and role
+func (c *ClusterCache) sizes() map[[2]string]float64 {
+	sizes := map[[2]string]float64{}
+	c.RLock()
+	defer c.RUnlock()
+	for _, cluster := range c.clusters {
+		roles := clusterRoles(cluster)
+		if len(roles) == 0 {
+			roles = []string{""}
+		}
+		for _, role := range roles {
+			sizes[[2]string{string(cluster.Type), role}]++
+		}
+	}
+	return sizes
+}
+
+func clusterRoles(cluster *CachedToolchainCluster) []string {
+	prefix := RoleLabel("")
+	var roles []string
+	for label := range cluster.Labels {
+		if strings.HasPrefix(label, prefix) {
+			roles = append(roles, strings.TrimPrefix(label, prefix))
+		}
+	}
+	return roles
+}
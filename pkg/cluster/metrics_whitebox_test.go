@@ -0,0 +1,122 @@
+package cluster
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/h2non/gock.v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestCacheSizeMetric(t *testing.T) {
+	// given
+	cache := NewClusterCache()
+
+	// when
+	cache.addCachedToolchainCluster(newTestCachedToolchainCluster(t, "host", Host))
+	cache.addCachedToolchainCluster(newTestCachedToolchainCluster(t, "member-1", Member, withRoles("tenant")))
+	cache.addCachedToolchainCluster(newTestCachedToolchainCluster(t, "member-2", Member, withRoles("tenant", "workspace")))
+	cache.addCachedToolchainCluster(newTestCachedToolchainCluster(t, "member-3", Member))
+
+	// then
+	assertCacheSize(t, cache, `
+toolchain_cluster_cache_clusters{role="",type="host"} 1
+toolchain_cluster_cache_clusters{role="",type="member"} 1
+toolchain_cluster_cache_clusters{role="tenant",type="member"} 2
+toolchain_cluster_cache_clusters{role="workspace",type="member"} 1
+`)
+
+	t.Run("deleted clusters are not counted", func(t *testing.T) {
+		// when
+		cache.deleteCachedToolchainCluster("member-2")
+		cache.deleteCachedToolchainClustersExcept(map[string]bool{"member-1": true, "member-2": true})
+
+		// then
+		assertCacheSize(t, cache, `
+toolchain_cluster_cache_clusters{role="tenant",type="member"} 1
+`)
+	})
+
+	t.Run("other cache doesn't change the metric", func(t *testing.T) {
+		// when
+		other := NewClusterCache()
+		other.addCachedToolchainCluster(newTestCachedToolchainCluster(t, "host", Host))
+
+		// then
+		assertCacheSize(t, cache, `
+toolchain_cluster_cache_clusters{role="tenant",type="member"} 1
+`)
+		assertCacheSize(t, other, `
+toolchain_cluster_cache_clusters{role="",type="host"} 1
+`)
+	})
+}
+
+func assertCacheSize(t *testing.T, cache *ClusterCache, expected string) {
+	expected = `
+# HELP toolchain_cluster_cache_clusters Number of the clusters in the cache by the cluster type and role
+# TYPE toolchain_cluster_cache_clusters gauge` + expected
+	assert.NoError(t, testutil.CollectAndCompare(cache.SizeCollector(), strings.NewReader(expected)))
+}
+
+func TestRefreshMetrics(t *testing.T) {
+	// given
+	defer gock.Off()
+	status := test.NewClusterStatus(toolchainv1alpha1.ToolchainClusterReady, corev1.ConditionTrue)
+	toolchainCluster, sec := test.NewToolchainCluster("east", "secret", status, map[string]string{"ownerClusterName": test.NameMember})
+	cl := test.NewFakeClient(t, toolchainCluster, sec)
+	cache := NewClusterCache()
+	service := NewToolchainClusterServiceWithCache(cache, cl, logf.Log, "test-namespace", 0, func(config *rest.Config, options client.Options) (client.Client, error) {
+		// make sure that insecure is false to make Gock mocking working properly
+		copiedConfig := rest.CopyConfig(config)
+		copiedConfig.Insecure = false
+		return client.New(copiedConfig, options)
+	})
+	refreshes := testutil.ToFloat64(cacheRefreshCounter.WithLabelValues(refreshOperation))
+	resyncs := testutil.ToFloat64(cacheRefreshCounter.WithLabelValues(resyncOperation))
+	rebuilds := testutil.ToFloat64(clientRebuildCounter.WithLabelValues("east"))
+
+	t.Run("refresh on cache miss", func(t *testing.T) {
+		// when
+		_, ok := cache.GetCachedToolchainCluster("east")
+
+		// then
+		require.True(t, ok)
+		assert.Equal(t, refreshes+1, testutil.ToFloat64(cacheRefreshCounter.WithLabelValues(refreshOperation)))
+		assert.Equal(t, rebuilds+1, testutil.ToFloat64(clientRebuildCounter.WithLabelValues("east")))
+	})
+
+	t.Run("resync doesn't rebuild the client when the config is the same", func(t *testing.T) {
+		// when
+		err := service.Resync(context.TODO())
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, resyncs+1, testutil.ToFloat64(cacheRefreshCounter.WithLabelValues(resyncOperation)))
+		assert.Equal(t, rebuilds+1, testutil.ToFloat64(clientRebuildCounter.WithLabelValues("east")))
+		assert.Equal(t, 2, testutil.CollectAndCount(cacheRefreshDurationHistogram))
+	})
+
+	t.Run("resync rebuilds the client when the config is changed", func(t *testing.T) {
+		// given
+		sec.Data["token"] = []byte("rotated")
+		require.NoError(t, cl.Update(context.TODO(), sec))
+
+		// when
+		err := service.Resync(context.TODO())
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, resyncs+2, testutil.ToFloat64(cacheRefreshCounter.WithLabelValues(resyncOperation)))
+		assert.Equal(t, rebuilds+2, testutil.ToFloat64(clientRebuildCounter.WithLabelValues("east")))
+	})
+}
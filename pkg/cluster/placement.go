@@ -0,0 +1,200 @@
+package cluster
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PlacementStrategy ranks the candidate member clusters when selecting the target cluster of a new workload
+type PlacementStrategy interface {
+	// Name is the name of the strategy used in the reason of the placement decision
+	Name() string
+	// Rank returns the rank of each of the given candidates (in the same order as the candidates).
+	// The candidates with the highest rank are preferred. The NaN ranks are the lowest ones.
+	Rank(candidates []*CachedToolchainCluster) []float64
+}
+
+// SelectMember selects one of the member clusters that match all the given conditions using the given strategies.
+// The strategies are applied in the given order - each of them keeps only the candidates with the highest rank,
+// so the following strategies are used only to break the ties of the previous ones. If there is still more than
+// one candidate at the end, then the first one sorted by name is selected, so the choice is always deterministic.
+// Returns the selected cluster, a reason of the choice, and info if any cluster was selected.
+func SelectMember(strategies []PlacementStrategy, conditions ...Condition) (*CachedToolchainCluster, string, bool) {
+	return clusterCache.SelectMember(strategies, conditions...)
+}
+
+// SelectMember selects one of the member clusters from the cache that match all the given conditions using the given strategies.
+// See the SelectMember function for more details.
+func (c *ClusterCache) SelectMember(strategies []PlacementStrategy, conditions ...Condition) (*CachedToolchainCluster, string, bool) {
+	candidates := c.GetMemberClusters(conditions...)
+	return selectCluster(candidates, strategies)
+}
+
+func selectCluster(candidates []*CachedToolchainCluster, strategies []PlacementStrategy) (*CachedToolchainCluster, string, bool) {
+	if len(candidates) == 0 {
+		return nil, "no member cluster matches the conditions", false
+	}
+	candidates = sortedByName(candidates)
+
+	var decidedBy []string
+	for _, strategy := range strategies {
+		if len(candidates) == 1 {
+			break
+		}
+		ranks := strategy.Rank(candidates)
+		if len(ranks) != len(candidates) {
+			continue
+		}
+		for i, rank := range ranks {
+			// NaN is not comparable, so it would never be the best rank
+			if math.IsNaN(rank) {
+				ranks[i] = math.Inf(-1)
+			}
+		}
+		best := ranks[0]
+		for _, rank := range ranks[1:] {
+			if rank > best {
+				best = rank
+			}
+		}
+		preferred := make([]*CachedToolchainCluster, 0, len(candidates))
+		for i, rank := range ranks {
+			if rank == best {
+				preferred = append(preferred, candidates[i])
+			}
+		}
+		if len(preferred) > 0 && len(preferred) < len(candidates) {
+			decidedBy = append(decidedBy, strategy.Name())
+			candidates = preferred
+		}
+	}
+
+	selected := candidates[0]
+	switch {
+	case len(decidedBy) == 0 && len(candidates) == 1:
+		return selected, fmt.Sprintf("cluster '%s' is the only candidate", selected.Name), true
+	case len(decidedBy) == 0:
+		return selected, fmt.Sprintf("cluster '%s' is the first candidate sorted by name", selected.Name), true
+	case len(candidates) > 1:
+		return selected, fmt.Sprintf("cluster '%s' was preferred by [%s] and is the first candidate sorted by name", selected.Name, strings.Join(decidedBy, ", ")), true
+	default:
+		return selected, fmt.Sprintf("cluster '%s' was preferred by [%s]", selected.Name, strings.Join(decidedBy, ", ")), true
+	}
+}
+
+func sortedByName(clusters []*CachedToolchainCluster) []*CachedToolchainCluster {
+	sorted := make([]*CachedToolchainCluster, len(clusters))
+	copy(sorted, clusters)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// RoundRobin returns a strategy that prefers the candidates one after another in each subsequent placement
+func RoundRobin() PlacementStrategy {
+	return &roundRobin{}
+}
+
+type roundRobin struct {
+	sync.Mutex
+	next int
+}
+
+func (s *roundRobin) Name() string {
+	return "round-robin"
+}
+
+func (s *roundRobin) Rank(candidates []*CachedToolchainCluster) []float64 {
+	ranks := make([]float64, len(candidates))
+	if len(candidates) == 0 {
+		return ranks
+	}
+	s.Lock()
+	defer s.Unlock()
+	ranks[s.next%len(candidates)] = 1
+	s.next++
+	return ranks
+}
+
+// UsageFunc returns the usage of the given cluster, eg. the percentage of the consumed memory
+type UsageFunc func(cluster *CachedToolchainCluster) float64
+
+// LeastLoaded returns a strategy that prefers the candidates with the lowest usage returned by the given function
+func LeastLoaded(usage UsageFunc) PlacementStrategy {
+	return leastLoaded{usage: usage}
+}
+
+type leastLoaded struct {
+	usage UsageFunc
+}
+
+func (s leastLoaded) Name() string {
+	return "least-loaded"
+}
+
+func (s leastLoaded) Rank(candidates []*CachedToolchainCluster) []float64 {
+	ranks := make([]float64, len(candidates))
+	for i, candidate := range candidates {
+		ranks[i] = -s.usage(candidate)
+	}
+	return ranks
+}
+
+// WeightedByLabel returns a strategy that prefers the candidates with the highest weight set as a numeric value of the given label.
+// The candidates without the label (or with a value that is not a finite number) have a weight of 0.
+func WeightedByLabel(labelKey string) PlacementStrategy {
+	return weightedByLabel{labelKey: labelKey}
+}
+
+type weightedByLabel struct {
+	labelKey string
+}
+
+func (s weightedByLabel) Name() string {
+	return fmt.Sprintf("weighted-by-label(%s)", s.labelKey)
+}
+
+func (s weightedByLabel) Rank(candidates []*CachedToolchainCluster) []float64 {
+	ranks := make([]float64, len(candidates))
+	for i, candidate := range candidates {
+		if candidate.Config == nil {
+			continue
+		}
+		if weight, err := strconv.ParseFloat(candidate.Labels[s.labelKey], 64); err == nil && !math.IsNaN(weight) && !math.IsInf(weight, 0) {
+			ranks[i] = weight
+		}
+	}
+	return ranks
+}
+
+// PreferExisting returns a strategy that prefers the candidates with the given names, eg. the clusters the user already has some workloads in
+func PreferExisting(clusterNames ...string) PlacementStrategy {
+	names := make(map[string]bool, len(clusterNames))
+	for _, name := range clusterNames {
+		names[name] = true
+	}
+	return preferExisting{names: names}
+}
+
+type preferExisting struct {
+	names map[string]bool
+}
+
+func (s preferExisting) Name() string {
+	return "prefer-existing"
+}
+
+func (s preferExisting) Rank(candidates []*CachedToolchainCluster) []float64 {
+	ranks := make([]float64, len(candidates))
+	for i, candidate := range candidates {
+		if s.names[candidate.Name] {
+			ranks[i] = 1
+		}
+	}
+	return ranks
+}
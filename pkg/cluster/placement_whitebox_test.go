@@ -0,0 +1,191 @@
+package cluster
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectMember(t *testing.T) {
+	// given
+	member1 := newTestCachedToolchainCluster(t, "member-1", Member, ready)
+	member2 := newTestCachedToolchainCluster(t, "member-2", Member, ready, withWeight("1"))
+	member3 := newTestCachedToolchainCluster(t, "member-3", Member, ready, withWeight("5"))
+	member4 := newTestCachedToolchainCluster(t, "member-4", Member, notReady, withWeight("10"))
+	host := newTestCachedToolchainCluster(t, "host", Host, ready)
+	cache := NewClusterCache()
+	for _, cluster := range []*CachedToolchainCluster{member3, member1, member4, member2, host} {
+		cache.addCachedToolchainCluster(cluster)
+	}
+	usage := map[string]float64{
+		"member-1": 50,
+		"member-2": 20,
+		"member-3": 20,
+		"member-4": 0,
+	}
+	usageFunc := func(cluster *CachedToolchainCluster) float64 {
+		return usage[cluster.Name]
+	}
+
+	t.Run("no strategy selects the first one by name", func(t *testing.T) {
+		// when
+		selected, reason, ok := cache.SelectMember(nil, Ready)
+
+		// then
+		require.True(t, ok)
+		assert.Equal(t, member1, selected)
+		assert.Equal(t, "cluster 'member-1' is the first candidate sorted by name", reason)
+	})
+
+	t.Run("no cluster matches the conditions", func(t *testing.T) {
+		// when
+		selected, reason, ok := cache.SelectMember([]PlacementStrategy{RoundRobin()}, WithRole("unknown"))
+
+		// then
+		require.False(t, ok)
+		assert.Nil(t, selected)
+		assert.Equal(t, "no member cluster matches the conditions", reason)
+	})
+
+	t.Run("the only candidate", func(t *testing.T) {
+		// when
+		selected, reason, ok := cache.SelectMember([]PlacementStrategy{LeastLoaded(usageFunc)}, Ready, func(cluster *CachedToolchainCluster) bool {
+			return cluster.Name == "member-1"
+		})
+
+		// then
+		require.True(t, ok)
+		assert.Equal(t, member1, selected)
+		assert.Equal(t, "cluster 'member-1' is the only candidate", reason)
+	})
+
+	t.Run("round robin", func(t *testing.T) {
+		// given
+		strategy := RoundRobin()
+		var selectedNames []string
+
+		for i := 0; i < 4; i++ {
+			// when
+			selected, reason, ok := cache.SelectMember([]PlacementStrategy{strategy}, Ready)
+
+			// then
+			require.True(t, ok)
+			assert.Equal(t, "cluster '"+selected.Name+"' was preferred by [round-robin]", reason)
+			selectedNames = append(selectedNames, selected.Name)
+		}
+		assert.Equal(t, []string{"member-1", "member-2", "member-3", "member-1"}, selectedNames)
+	})
+
+	t.Run("least loaded", func(t *testing.T) {
+		// when
+		selected, reason, ok := cache.SelectMember([]PlacementStrategy{LeastLoaded(usageFunc)}, Ready)
+
+		// then
+		require.True(t, ok)
+		assert.Equal(t, member2, selected)
+		assert.Equal(t, "cluster 'member-2' was preferred by [least-loaded] and is the first candidate sorted by name", reason)
+	})
+
+	t.Run("least loaded with tie broken by weight", func(t *testing.T) {
+		// when
+		selected, reason, ok := cache.SelectMember([]PlacementStrategy{LeastLoaded(usageFunc), WeightedByLabel(weightLabel)}, Ready)
+
+		// then
+		require.True(t, ok)
+		assert.Equal(t, member3, selected)
+		assert.Equal(t, "cluster 'member-3' was preferred by [least-loaded, weighted-by-label(weight)]", reason)
+	})
+
+	t.Run("weighted by label", func(t *testing.T) {
+		// when
+		selected, _, ok := cache.SelectMember([]PlacementStrategy{WeightedByLabel(weightLabel)})
+
+		// then
+		require.True(t, ok)
+		assert.Equal(t, member4, selected)
+	})
+
+	t.Run("prefer existing", func(t *testing.T) {
+		// when
+		selected, reason, ok := cache.SelectMember([]PlacementStrategy{PreferExisting("member-3", "member-4"), LeastLoaded(usageFunc)}, Ready)
+
+		// then
+		require.True(t, ok)
+		assert.Equal(t, member3, selected)
+		assert.Equal(t, "cluster 'member-3' was preferred by [prefer-existing]", reason)
+	})
+
+	t.Run("prefer existing when the user has no cluster yet", func(t *testing.T) {
+		// when
+		selected, reason, ok := cache.SelectMember([]PlacementStrategy{PreferExisting(), LeastLoaded(usageFunc), WeightedByLabel(weightLabel)}, Ready)
+
+		// then
+		require.True(t, ok)
+		assert.Equal(t, member3, selected)
+		assert.Equal(t, "cluster 'member-3' was preferred by [least-loaded, weighted-by-label(weight)]", reason)
+	})
+}
+
+func TestSelectMemberWithInvalidRanks(t *testing.T) {
+	// given
+	cache := NewClusterCache()
+	cache.addCachedToolchainCluster(newTestCachedToolchainCluster(t, "member-1", Member, ready, withWeight("NaN")))
+	cache.addCachedToolchainCluster(newTestCachedToolchainCluster(t, "member-2", Member, ready, withWeight("not-a-number")))
+	cache.addCachedToolchainCluster(newTestCachedToolchainCluster(t, "member-3", Member, ready, withWeight("+Inf")))
+
+	t.Run("weights that are not finite numbers are ignored", func(t *testing.T) {
+		// when
+		selected, reason, ok := cache.SelectMember([]PlacementStrategy{WeightedByLabel(weightLabel)}, Ready)
+
+		// then
+		require.True(t, ok)
+		assert.Equal(t, "member-1", selected.Name)
+		assert.Equal(t, "cluster 'member-1' is the first candidate sorted by name", reason)
+	})
+
+	t.Run("NaN ranks are the lowest ones", func(t *testing.T) {
+		// given
+		usageFunc := func(cluster *CachedToolchainCluster) float64 {
+			if cluster.Name == "member-3" {
+				return 90
+			}
+			return math.NaN()
+		}
+
+		// when
+		selected, reason, ok := cache.SelectMember([]PlacementStrategy{LeastLoaded(usageFunc)}, Ready)
+
+		// then
+		require.True(t, ok)
+		assert.Equal(t, "member-3", selected.Name)
+		assert.Equal(t, "cluster 'member-3' was preferred by [least-loaded]", reason)
+	})
+
+	t.Run("all ranks are NaN", func(t *testing.T) {
+		// given
+		usageFunc := func(cluster *CachedToolchainCluster) float64 {
+			return math.NaN()
+		}
+
+		// when
+		selected, reason, ok := cache.SelectMember([]PlacementStrategy{LeastLoaded(usageFunc)}, Ready)
+
+		// then
+		require.True(t, ok)
+		assert.Equal(t, "member-1", selected.Name)
+		assert.Equal(t, "cluster 'member-1' is the first candidate sorted by name", reason)
+	})
+}
+
+const weightLabel = "weight"
+
+func withWeight(weight string) clusterOption {
+	return func(c *CachedToolchainCluster) {
+		if c.Labels == nil {
+			c.Labels = map[string]string{}
+		}
+		c.Labels[weightLabel] = weight
+	}
+}
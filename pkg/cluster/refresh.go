@@ -0,0 +1,70 @@
+package cluster
+
+import (
+	"sync"
+	"time"
+)
+
+// refresher makes sure that there is only one refresh of the cache running at a time
+// and that the concurrent cache misses are coalesced into a single refresh
+type refresher struct {
+	sync.Mutex
+	// started is the number of refreshes started so far - it's used as a generation of the refresh
+	started uint64
+	// completed is the generation of the last completed refresh
+	completed uint64
+	// inflight is the currently running refresh (if any)
+	inflight *refreshCall
+}
+
+type refreshCall struct {
+	done chan struct{}
+}
+
+// generation returns the generation of the last started refresh. It has to be retrieved before the cache is checked,
+// so the refresh can be skipped when another one was started (and completed) after the cache miss.
+func (r *refresher) generation() uint64 {
+	r.Lock()
+	defer r.Unlock()
+	return r.started
+}
+
+// refresh calls the refreshCache function unless a refresh that started after the given generation has already completed.
+// If there is a refresh running, then it waits for it instead of running another one concurrently.
+func (c *ClusterCache) refresh(generation uint64) {
+	if c.refreshCache == nil {
+		return
+	}
+	r := &c.refresher
+	for {
+		r.Lock()
+		if r.completed > generation {
+			// there was a refresh that started after the cache miss, so it already contains the latest data
+			r.Unlock()
+			return
+		}
+		call := r.inflight
+		if call == nil {
+			break
+		}
+		// wait for the running refresh - if it started before the cache miss, then another one is started after it
+		r.Unlock()
+		<-call.done
+	}
+	r.started++
+	call := &refreshCall{done: make(chan struct{})}
+	r.inflight = call
+	currentGeneration := r.started
+	r.Unlock()
+
+	// the refresh is observed only after it's marked as completed, so the waiting lookups are not delayed by the metrics
+	defer observeRefresh(refreshOperation, time.Now())
+	defer func() {
+		r.Lock()
+		r.completed = currentGeneration
+		r.inflight = nil
+		r.Unlock()
+		close(call.done)
+	}()
+	c.refreshCache()
+}
@@ -0,0 +1,266 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/toolchain-common/pkg/apis"
+	commonclient "github.com/codeready-toolchain/toolchain-common/pkg/client"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultRegistrationTokenExpiration is the default expiration of the tokens created for the ServiceAccounts during the registration
+	DefaultRegistrationTokenExpiration = 365 * 24 * time.Hour
+
+	// registrationClientTimeout is the timeout of the clients used for verifying the connection to the registered clusters
+	registrationClientTimeout = 10 * time.Second
+)
+
+// RegistrationEndpoint is one side of the host-member pair that is being registered
+type RegistrationEndpoint struct {
+	// Name is the name of the ToolchainCluster that represents this cluster in the other cluster
+	Name string
+	// OperatorNamespace is the namespace the operator runs in
+	OperatorNamespace string
+	// APIEndpoint is the API endpoint of this cluster as it is reachable from the other cluster
+	APIEndpoint string
+	// CABundle is the base64 encoded CA bundle of the API server of this cluster (optional)
+	CABundle string
+	// Client is a client with admin credentials used for creating the resources in this cluster
+	Client client.Client
+	// RESTClient is a REST client with admin credentials used for creating the tokens of the ServiceAccount in this cluster
+	RESTClient *rest.RESTClient
+}
+
+// Registration is the result of the registration of a host-member pair
+type Registration struct {
+	// Host is the ToolchainCluster created in the member cluster that represents the host cluster
+	Host *toolchainv1alpha1.ToolchainCluster
+	// Member is the ToolchainCluster created in the host cluster that represents the member cluster
+	Member *toolchainv1alpha1.ToolchainCluster
+	// HostReport is the diagnostics of the connection to the host cluster using the credentials stored in the member cluster
+	HostReport *DiagnosticReport
+	// MemberReport is the diagnostics of the connection to the member cluster using the credentials stored in the host cluster
+	MemberReport *DiagnosticReport
+}
+
+// RegistrationOption is an option of the registration
+type RegistrationOption func(*registrationConfig)
+
+type registrationConfig struct {
+	tokenExpiration time.Duration
+	newClient       NewClient
+	diagnoseOptions []DiagnoseOption
+}
+
+// WithTokenExpiration sets the expiration of the tokens created for the ServiceAccounts (DefaultRegistrationTokenExpiration by default)
+func WithTokenExpiration(expiration time.Duration) RegistrationOption {
+	return func(config *registrationConfig) {
+		config.tokenExpiration = expiration
+	}
+}
+
+// WithVerificationClient sets the function that creates the clients used for verifying the connection to the registered clusters
+func WithVerificationClient(newClient NewClient) RegistrationOption {
+	return func(config *registrationConfig) {
+		config.newClient = newClient
+	}
+}
+
+// WithVerificationOptions sets the options of the diagnostics used for verifying the connection to the registered clusters
+func WithVerificationOptions(options ...DiagnoseOption) RegistrationOption {
+	return func(config *registrationConfig) {
+		config.diagnoseOptions = options
+	}
+}
+
+// RegisterMember registers the member cluster in the host cluster and vice versa. For each side, it creates a ServiceAccount
+// in the operator namespace of the cluster, creates a token of the ServiceAccount and stores it in a Secret in the operator
+// namespace of the other cluster together with a ToolchainCluster pointing to the cluster. The existing resources are updated,
+// so the registration can be repeated, eg. to renew the tokens.
+//
+// Finally, it verifies that the clusters are reachable using the stored credentials. Note that the verification runs from where
+// this function is called, so it doesn't prove that the clusters can reach each other over their network.
+// If the verification fails, then the registration is returned together with the error, so the diagnostic reports can be inspected.
+// The permissions of the ServiceAccounts are not managed by the registration - they are expected to be granted by the operators.
+func RegisterMember(ctx context.Context, host, member RegistrationEndpoint, options ...RegistrationOption) (*Registration, error) {
+	config := &registrationConfig{
+		tokenExpiration: DefaultRegistrationTokenExpiration,
+	}
+	for _, apply := range options {
+		apply(config)
+	}
+	if err := host.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid host cluster")
+	}
+	if err := member.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid member cluster")
+	}
+
+	registration := &Registration{}
+	var err error
+	if registration.Member, err = register(ctx, config, member, Member, host); err != nil {
+		return nil, errors.Wrapf(err, "unable to register the member cluster %s in the host cluster", member.Name)
+	}
+	if registration.Host, err = register(ctx, config, host, Host, member); err != nil {
+		return nil, errors.Wrapf(err, "unable to register the host cluster %s in the member cluster", host.Name)
+	}
+
+	if registration.MemberReport, err = verify(ctx, config, host.Client, registration.Member); err != nil {
+		return registration, err
+	}
+	if registration.HostReport, err = verify(ctx, config, member.Client, registration.Host); err != nil {
+		return registration, err
+	}
+	return registration, nil
+}
+
+func (e RegistrationEndpoint) validate() error {
+	switch {
+	case e.Name == "":
+		return errors.New("the name is not set")
+	case len(validation.IsDNS1123Subdomain(e.Name)) > 0:
+		return errors.Errorf("the name %q is not valid: %s", e.Name, strings.Join(validation.IsDNS1123Subdomain(e.Name), ", "))
+	case e.OperatorNamespace == "":
+		return errors.New("the operator namespace is not set")
+	case e.APIEndpoint == "":
+		return errors.New("the API endpoint is not set")
+	case e.Client == nil || e.RESTClient == nil:
+		return errors.New("the clients are not set")
+	}
+	return nil
+}
+
+// register creates the ServiceAccount in the joining cluster and the Secret with its token together with the ToolchainCluster in the target cluster
+func register(ctx context.Context, config *registrationConfig, joining RegistrationEndpoint, clusterType Type, target RegistrationEndpoint) (*toolchainv1alpha1.ToolchainCluster, error) {
+	// validate the ToolchainCluster first, so nothing is created when it's not valid
+	expected := &toolchainv1alpha1.ToolchainCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      joining.Name,
+			Namespace: target.OperatorNamespace,
+			Labels: map[string]string{
+				LabelType:             string(clusterType),
+				labelNamespace:        joining.OperatorNamespace,
+				labelOwnerClusterName: target.Name,
+			},
+		},
+		Spec: toolchainv1alpha1.ToolchainClusterSpec{
+			APIEndpoint: joining.APIEndpoint,
+			CABundle:    joining.CABundle,
+			SecretRef:   toolchainv1alpha1.LocalSecretReference{Name: registrationSecretName(joining.Name)},
+		},
+	}
+	if errs := ValidateToolchainCluster(ctx, nil, expected); len(errs) > 0 {
+		return nil, errors.Wrapf(errs.ToAggregate(), "the ToolchainCluster %s is not valid", expected.Name)
+	}
+
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      registrationServiceAccountName(clusterType),
+			Namespace: joining.OperatorNamespace,
+		},
+	}
+	if err := joining.Client.Create(ctx, serviceAccount); err != nil && !apierrors.IsAlreadyExists(err) {
+		return nil, errors.Wrapf(err, "unable to create the ServiceAccount %s", serviceAccount.Name)
+	}
+	token, err := commonclient.CreateTokenRequest(ctx, joining.RESTClient, types.NamespacedName{Namespace: serviceAccount.Namespace, Name: serviceAccount.Name},
+		int(config.tokenExpiration.Seconds()))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create a token for the ServiceAccount %s", serviceAccount.Name)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      expected.Spec.SecretRef.Name,
+			Namespace: target.OperatorNamespace,
+		},
+	}
+	if err := createOrUpdate(ctx, target.Client, secret, func() {
+		secret.Type = corev1.SecretTypeOpaque
+		secret.Data = map[string][]byte{
+			ToolchainTokenKey: []byte(token),
+		}
+	}); err != nil {
+		return nil, errors.Wrapf(err, "unable to store the token in the Secret %s", secret.Name)
+	}
+
+	toolchainCluster := &toolchainv1alpha1.ToolchainCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      expected.Name,
+			Namespace: expected.Namespace,
+		},
+	}
+	if err := createOrUpdate(ctx, target.Client, toolchainCluster, func() {
+		if toolchainCluster.Labels == nil {
+			toolchainCluster.Labels = map[string]string{}
+		}
+		for key, value := range expected.Labels {
+			toolchainCluster.Labels[key] = value
+		}
+		toolchainCluster.Spec.APIEndpoint = expected.Spec.APIEndpoint
+		toolchainCluster.Spec.CABundle = expected.Spec.CABundle
+		toolchainCluster.Spec.SecretRef = expected.Spec.SecretRef
+	}); err != nil {
+		return nil, errors.Wrapf(err, "unable to store the ToolchainCluster %s", toolchainCluster.Name)
+	}
+	return toolchainCluster, nil
+}
+
+// createOrUpdate retrieves the given object, applies the given mutation and creates or updates the object in the cluster
+func createOrUpdate(ctx context.Context, cl client.Client, obj client.Object, mutate func()) error {
+	err := cl.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+	mutate()
+	if exists {
+		return cl.Update(ctx, obj)
+	}
+	return cl.Create(ctx, obj)
+}
+
+// verify diagnoses the connection to the cluster represented by the given ToolchainCluster using the credentials stored in the given cluster
+func verify(ctx context.Context, config *registrationConfig, cl client.Client, toolchainCluster *toolchainv1alpha1.ToolchainCluster) (*DiagnosticReport, error) {
+	clusterConfig, err := NewClusterConfig(cl, toolchainCluster, registrationClientTimeout)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create the config of the cluster %s", toolchainCluster.Name)
+	}
+	scheme := runtime.NewScheme()
+	if err := apis.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	newClient := config.newClient
+	if newClient == nil {
+		newClient = client.New
+	}
+	clusterClient, err := newClient(clusterConfig.RestConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create the client of the cluster %s", toolchainCluster.Name)
+	}
+	report := Diagnose(ctx, &CachedToolchainCluster{Config: clusterConfig, Client: clusterClient}, config.diagnoseOptions...)
+	if !report.Healthy() {
+		return report, fmt.Errorf("the cluster %s is not reachable with the registered credentials: %s", toolchainCluster.Name, report.Summary())
+	}
+	return report, nil
+}
+
+func registrationServiceAccountName(clusterType Type) string {
+	return fmt.Sprintf("toolchaincluster-%s", clusterType)
+}
+
+func registrationSecretName(toolchainClusterName string) string {
+	return fmt.Sprintf("%s-token", toolchainClusterName)
+}
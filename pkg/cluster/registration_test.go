@@ -0,0 +1,214 @@
+package cluster_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/toolchain-common/pkg/cluster"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/h2non/gock.v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestRegisterMember(t *testing.T) {
+	// given
+	hostServer, hostCABundle := newAPIServer(t)
+	memberServer, memberCABundle := newAPIServer(t)
+	verificationClient := cluster.WithVerificationClient(func(config *rest.Config, options client.Options) (client.Client, error) {
+		return test.NewFakeClient(t), nil
+	})
+
+	newEndpoints := func(t *testing.T) (cluster.RegistrationEndpoint, cluster.RegistrationEndpoint) {
+		test.SetupGockForServiceAccounts(t, "https://host-admin.com", types.NamespacedName{Namespace: "toolchain-host-operator", Name: "toolchaincluster-host"})
+		test.SetupGockForServiceAccounts(t, "https://member-admin.com", types.NamespacedName{Namespace: "toolchain-member-operator", Name: "toolchaincluster-member"})
+		return cluster.RegistrationEndpoint{
+			Name:              "host-cluster",
+			OperatorNamespace: "toolchain-host-operator",
+			APIEndpoint:       hostServer.URL,
+			CABundle:          hostCABundle,
+			Client:            test.NewFakeClient(t),
+			RESTClient:        newAdminRESTClient(t, "https://host-admin.com"),
+		}, cluster.RegistrationEndpoint{
+			Name:              "member-cluster",
+			OperatorNamespace: "toolchain-member-operator",
+			APIEndpoint:       memberServer.URL,
+			CABundle:          memberCABundle,
+			Client:            test.NewFakeClient(t),
+			RESTClient:        newAdminRESTClient(t, "https://member-admin.com"),
+		}
+	}
+
+	t.Run("registers both clusters", func(t *testing.T) {
+		// given
+		host, member := newEndpoints(t)
+
+		// when
+		registration, err := cluster.RegisterMember(context.TODO(), host, member, verificationClient)
+
+		// then
+		require.NoError(t, err)
+		assertRegistered(t, member, host, cluster.Member, "token-secret-for-toolchaincluster-member", registration.Member)
+		assertRegistered(t, host, member, cluster.Host, "token-secret-for-toolchaincluster-host", registration.Host)
+		assert.True(t, registration.MemberReport.Healthy())
+		assert.Equal(t, "member-cluster", registration.MemberReport.ClusterName)
+		assert.True(t, registration.HostReport.Healthy())
+		assert.Equal(t, "host-cluster", registration.HostReport.ClusterName)
+	})
+
+	t.Run("registration can be repeated", func(t *testing.T) {
+		// given
+		host, member := newEndpoints(t)
+		_, err := cluster.RegisterMember(context.TODO(), host, member, verificationClient)
+		require.NoError(t, err)
+		member.APIEndpoint = memberServer.URL + "/"
+
+		// when
+		registration, err := cluster.RegisterMember(context.TODO(), host, member, verificationClient)
+
+		// then
+		require.NoError(t, err)
+		assertRegistered(t, member, host, cluster.Member, "token-secret-for-toolchaincluster-member", registration.Member)
+		assertRegistered(t, host, member, cluster.Host, "token-secret-for-toolchaincluster-host", registration.Host)
+		assert.Len(t, listObjects(t, host.Client, &toolchainv1alpha1.ToolchainClusterList{}).Items, 1)
+		assert.Len(t, listObjects(t, host.Client, &corev1.SecretList{}).Items, 1)
+	})
+
+	t.Run("verification fails", func(t *testing.T) {
+		// given
+		host, member := newEndpoints(t)
+
+		// when
+		registration, err := cluster.RegisterMember(context.TODO(), host, member, verificationClient,
+			cluster.WithVerificationOptions(cluster.WithRequiredPermissions(authorizationv1.ResourceAttributes{Verb: "delete", Resource: "secrets"})))
+
+		// then
+		require.EqualError(t, err, "the cluster member-cluster is not reachable with the registered credentials: "+
+			"Permissions failed: missing permissions: delete secrets in namespace toolchain-member-operator")
+		require.NotNil(t, registration)
+		assertRegistered(t, member, host, cluster.Member, "token-secret-for-toolchaincluster-member", registration.Member)
+		assert.False(t, registration.MemberReport.Healthy())
+		assert.Nil(t, registration.HostReport)
+	})
+
+	t.Run("invalid endpoint", func(t *testing.T) {
+		// given
+		host, member := newEndpoints(t)
+		member.OperatorNamespace = ""
+
+		// when
+		_, err := cluster.RegisterMember(context.TODO(), host, member, verificationClient)
+
+		// then
+		require.EqualError(t, err, "invalid member cluster: the operator namespace is not set")
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+		// given
+		host, member := newEndpoints(t)
+		member.Name = "Member_Cluster"
+
+		// when
+		_, err := cluster.RegisterMember(context.TODO(), host, member, verificationClient)
+
+		// then
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `invalid member cluster: the name "Member_Cluster" is not valid`)
+	})
+
+	t.Run("invalid ToolchainCluster is not created", func(t *testing.T) {
+		// given
+		host, member := newEndpoints(t)
+		member.APIEndpoint = "ftp://member-cluster.com"
+
+		// when
+		_, err := cluster.RegisterMember(context.TODO(), host, member, verificationClient)
+
+		// then
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unable to register the member cluster member-cluster in the host cluster: the ToolchainCluster member-cluster is not valid: spec.apiEndpoint")
+		assert.Empty(t, listObjects(t, host.Client, &toolchainv1alpha1.ToolchainClusterList{}).Items)
+		assert.Empty(t, listObjects(t, host.Client, &corev1.SecretList{}).Items)
+		assert.Empty(t, listObjects(t, member.Client, &corev1.ServiceAccountList{}).Items)
+	})
+
+	t.Run("token cannot be created", func(t *testing.T) {
+		// given
+		host, member := newEndpoints(t)
+		member.RESTClient = newAdminRESTClient(t, "https://unknown-admin.com")
+
+		// when
+		_, err := cluster.RegisterMember(context.TODO(), host, member, verificationClient)
+
+		// then
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unable to register the member cluster member-cluster in the host cluster: unable to create a token for the ServiceAccount toolchaincluster-member")
+	})
+}
+
+func assertRegistered(t *testing.T, joining, target cluster.RegistrationEndpoint, clusterType cluster.Type, expectedToken string, toolchainCluster *toolchainv1alpha1.ToolchainCluster) {
+	serviceAccount := &corev1.ServiceAccount{}
+	require.NoError(t, joining.Client.Get(context.TODO(), test.NamespacedName(joining.OperatorNamespace, "toolchaincluster-"+string(clusterType)), serviceAccount))
+
+	actual := &toolchainv1alpha1.ToolchainCluster{}
+	require.NoError(t, target.Client.Get(context.TODO(), test.NamespacedName(target.OperatorNamespace, joining.Name), actual))
+	assert.Equal(t, map[string]string{
+		cluster.LabelType:  string(clusterType),
+		"namespace":        joining.OperatorNamespace,
+		"ownerClusterName": target.Name,
+	}, actual.Labels)
+	assert.Equal(t, joining.APIEndpoint, actual.Spec.APIEndpoint)
+	assert.Equal(t, joining.CABundle, actual.Spec.CABundle)
+	assert.Equal(t, actual.Spec, toolchainCluster.Spec)
+
+	secret := &corev1.Secret{}
+	require.NoError(t, target.Client.Get(context.TODO(), test.NamespacedName(target.OperatorNamespace, actual.Spec.SecretRef.Name), secret))
+	assert.Equal(t, expectedToken, string(secret.Data["token"]))
+}
+
+func listObjects[T client.ObjectList](t *testing.T, cl client.Client, list T) T {
+	require.NoError(t, cl.List(context.TODO(), list))
+	return list
+}
+
+// newAPIServer starts a TLS server that responds to the requests of the connection diagnostics and returns it together with its CA bundle
+func newAPIServer(t *testing.T) (*httptest.Server, string) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/healthz":
+			_, _ = w.Write([]byte("ok"))
+		case "/version":
+			_, _ = w.Write([]byte(`{"major":"1","minor":"25","gitVersion":"v1.25.0"}`))
+		case "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews":
+			review := &authorizationv1.SelfSubjectAccessReview{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(review))
+			review.Status.Allowed = review.Spec.ResourceAttributes.Resource == "toolchainclusters"
+			w.WriteHeader(http.StatusCreated)
+			assert.NoError(t, json.NewEncoder(w).Encode(review))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	caData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	return server, base64.StdEncoding.EncodeToString(caData)
+}
+
+func newAdminRESTClient(t *testing.T, apiEndpoint string) *rest.RESTClient {
+	cl, err := test.NewRESTClient("admin-token", apiEndpoint)
+	require.NoError(t, err)
+	cl.Client.Transport = gock.DefaultTransport // make sure that the requests are intercepted by Gock
+	return cl
+}
@@ -2,6 +2,7 @@ package cluster
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"fmt"
 	"reflect"
@@ -11,12 +12,16 @@ import (
 	"github.com/codeready-toolchain/toolchain-common/pkg/apis"
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
-	v1 "k8s.io/api/core/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	runtimecluster "sigs.k8s.io/controller-runtime/pkg/cluster"
 )
 
 const (
@@ -31,41 +36,81 @@ const (
 
 	toolchainAPIQPS   = 20.0
 	toolchainAPIBurst = 30
-	toolchainTokenKey = "token"
+
+	// ToolchainTokenKey is the key of the bearer token in the Secret referenced by ToolchainCluster
+	ToolchainTokenKey = "token"
+	// toolchainKubeconfigKey is the key of a whole kubeconfig in the Secret referenced by ToolchainCluster
+	toolchainKubeconfigKey = "kubeconfig"
+	// toolchainClientCertKey and toolchainClientKeyKey are the keys of the client certificate and its private key
+	// in the Secret referenced by ToolchainCluster
+	toolchainClientCertKey = corev1.TLSCertKey
+	toolchainClientKeyKey  = corev1.TLSPrivateKeyKey
 )
 
 // ToolchainClusterService manages cached cluster kube clients and related ToolchainCluster CRDs
 // it's used for adding/updating/deleting
 type ToolchainClusterService struct {
+	cache     *ClusterCache
 	client    client.Client
 	log       logr.Logger
 	namespace string
 	timeout   time.Duration
 	newClient NewClient
+	// informerCache is true when the clients of the clusters should read from a shared informer cache
+	informerCache bool
+	// newCluster is used for creating the informer-backed clusters, runtimecluster.New is used when nil
+	newCluster func(config *rest.Config, opts ...runtimecluster.Option) (runtimecluster.Cluster, error)
+	// defaultClientSettings contains the client settings set for the whole service - the unset values fall back to DefaultClientSettings
+	defaultClientSettings ClientSettings
+}
+
+// ServiceOption an option to configure the ToolchainClusterService
+type ServiceOption func(*ToolchainClusterService)
+
+// WithDefaultClientSettings sets the settings of the clients used for all the clusters that don't override them
+// in their annotations. The unset values fall back to DefaultClientSettings.
+func WithDefaultClientSettings(settings ClientSettings) ServiceOption {
+	return func(service *ToolchainClusterService) {
+		service.defaultClientSettings = settings
+	}
 }
 
 type NewClient func(config *rest.Config, options client.Options) (client.Client, error)
 
 // NewToolchainClusterServiceWithClient creates a new instance of ToolchainClusterService object and assigns the given newClient functione to be used for creating a client
-func NewToolchainClusterServiceWithClient(client client.Client, log logr.Logger, namespace string, timeout time.Duration, newClient NewClient) ToolchainClusterService {
-	service := NewToolchainClusterService(client, log, namespace, timeout)
-	service.newClient = newClient
-	clusterCache.refreshCache = service.refreshCache
-	return service
+// The service is bound to the default instance of the ClusterCache.
+func NewToolchainClusterServiceWithClient(client client.Client, log logr.Logger, namespace string, timeout time.Duration, newClient NewClient, options ...ServiceOption) ToolchainClusterService {
+	return NewToolchainClusterServiceWithCache(clusterCache, client, log, namespace, timeout, newClient, options...)
 }
 
-// NewToolchainClusterService creates a new instance of ToolchainClusterService object and assigns the refreshCache function to the cache instance
-func NewToolchainClusterService(client client.Client, log logr.Logger, namespace string, timeout time.Duration) ToolchainClusterService {
+// NewToolchainClusterService creates a new instance of ToolchainClusterService object and assigns the refreshCache function to the default cache instance
+func NewToolchainClusterService(client client.Client, log logr.Logger, namespace string, timeout time.Duration, options ...ServiceOption) ToolchainClusterService {
+	return NewToolchainClusterServiceWithCache(clusterCache, client, log, namespace, timeout, nil, options...)
+}
+
+// NewToolchainClusterServiceWithCache creates a new instance of ToolchainClusterService object that stores the clusters in the given cache
+// and assigns the refreshCache function to the cache instance. The newClient function is optional - if nil, then client.New is used for creating the clients.
+func NewToolchainClusterServiceWithCache(cache *ClusterCache, client client.Client, log logr.Logger, namespace string, timeout time.Duration, newClient NewClient, options ...ServiceOption) ToolchainClusterService {
 	service := ToolchainClusterService{
+		cache:     cache,
 		client:    client,
 		log:       log,
 		namespace: namespace,
 		timeout:   timeout,
+		newClient: newClient,
+	}
+	for _, configure := range options {
+		configure(&service)
 	}
-	clusterCache.refreshCache = service.refreshCache
+	cache.refreshCache = service.refreshCache
 	return service
 }
 
+// Cache returns the ClusterCache instance the service stores the clusters in
+func (s *ToolchainClusterService) Cache() *ClusterCache {
+	return s.cache
+}
+
 // AddOrUpdateToolchainCluster takes the ToolchainCluster CR object,
 // creates CachedToolchainCluster with a kube client and stores it in a cache
 func (s *ToolchainClusterService) AddOrUpdateToolchainCluster(cluster *toolchainv1alpha1.ToolchainCluster) error {
@@ -86,57 +131,82 @@ func RoleLabel(role Role) string {
 
 func (s *ToolchainClusterService) addToolchainCluster(log logr.Logger, toolchainCluster *toolchainv1alpha1.ToolchainCluster) error {
 	// create the restclient of toolchainCluster
-	clusterConfig, err := NewClusterConfig(s.client, toolchainCluster, s.timeout)
+	clusterConfig, err := NewClusterConfigWithClientSettings(s.client, toolchainCluster, s.defaultClientSettings.withDefaults(DefaultClientSettings(s.timeout)))
 	if err != nil {
 		return errors.Wrap(err, "cannot create ToolchainCluster Config")
 	}
+	if clusterConfig.Type == "" {
+		clusterConfig.Type = Member
+	}
+	if clusterConfig.OperatorNamespace == "" {
+		if clusterConfig.Type == Host {
+			clusterConfig.OperatorNamespace = defaultHostOperatorNamespace
+		} else {
+			clusterConfig.OperatorNamespace = defaultMemberOperatorNamespace
+		}
+	}
 
 	var cl client.Client
+	var clientset kubernetes.Interface
+	var runtimeCluster runtimecluster.Cluster
+	var stop context.CancelFunc
 	// check if there is already a cached ToolchainCluster so we could reuse the client
 	// we cannot allow to refresh the cache, because the refresh function calls this addToolchainCluster method which results in a recursive loop
-	cachedToolchainCluster, exists := clusterCache.getCachedToolchainCluster(toolchainCluster.Name, false)
+	cachedToolchainCluster, exists := s.cache.getCachedToolchainCluster(toolchainCluster.Name, false)
 	if !exists ||
 		cachedToolchainCluster.Client == nil ||
-		!reflect.DeepEqual(clusterConfig.RestConfig, cachedToolchainCluster.RestConfig) {
+		!reflect.DeepEqual(clusterConfig.RestConfig, cachedToolchainCluster.RestConfig) ||
+		// the informer cache is scoped to the operator namespace
+		(s.informerCache && clusterConfig.OperatorNamespace != cachedToolchainCluster.OperatorNamespace) {
 
 		log.Info("creating new client for the cached ToolchainCluster")
 		scheme := runtime.NewScheme()
 		if err := apis.AddToScheme(scheme); err != nil {
 			return err
 		}
-		if s.newClient == nil {
+		switch {
+		case s.informerCache:
+			runtimeCluster, stop, err = s.startRuntimeCluster(log, clusterConfig.RestConfig, clusterConfig.OperatorNamespace, scheme)
+			if err == nil {
+				cl = runtimeCluster.GetClient()
+			}
+		case s.newClient == nil:
 			cl, err = client.New(clusterConfig.RestConfig, client.Options{
 				Scheme: scheme,
 			})
-		} else {
+		default:
 			cl, err = s.newClient(clusterConfig.RestConfig, client.Options{
 				Scheme: scheme,
 			})
 		}
 		if err != nil {
-			return errors.Wrap(err, "cannot create ToolchainCluster client")
+			return newConfigurationError(ClientCreationFailedReason, errors.Wrap(err, "cannot create ToolchainCluster client"))
 		}
+		if clientset, err = kubernetes.NewForConfig(clusterConfig.RestConfig); err != nil {
+			if stop != nil {
+				// the informer cache was already started, but the cluster won't be cached
+				stop()
+			}
+			return newConfigurationError(ClientCreationFailedReason, errors.Wrap(err, "cannot create ToolchainCluster clientset"))
+		}
+		clientRebuildCounter.WithLabelValues(toolchainCluster.Name).Inc()
 	} else {
 		// log.Info("reusing the client for the cached ToolchainCluster")
 		cl = cachedToolchainCluster.Client
+		clientset = cachedToolchainCluster.Clientset
+		runtimeCluster = cachedToolchainCluster.Cluster
+		stop = cachedToolchainCluster.stop
 	}
 
 	cluster := &CachedToolchainCluster{
 		Config:        clusterConfig,
 		Client:        cl,
+		Clientset:     clientset,
+		Cluster:       runtimeCluster,
+		stop:          stop,
 		ClusterStatus: &toolchainCluster.Status,
 	}
-	if cluster.Type == "" {
-		cluster.Type = Member
-	}
-	if cluster.OperatorNamespace == "" {
-		if cluster.Type == Host {
-			cluster.OperatorNamespace = defaultHostOperatorNamespace
-		} else {
-			cluster.OperatorNamespace = defaultMemberOperatorNamespace
-		}
-	}
-	clusterCache.addCachedToolchainCluster(cluster)
+	s.cache.addCachedToolchainCluster(cluster)
 	return nil
 }
 
@@ -144,7 +214,45 @@ func (s *ToolchainClusterService) addToolchainCluster(log logr.Logger, toolchain
 // and deletes CachedToolchainCluster instance that has same name from a cache (if exists)
 func (s *ToolchainClusterService) DeleteToolchainCluster(name string) {
 	s.log.WithValues("Request.Name", name).Info("observed a deleted cluster")
-	clusterCache.deleteCachedToolchainCluster(name)
+	s.cache.deleteCachedToolchainCluster(name)
+}
+
+// StartPeriodicResync starts a background loop that resyncs the whole cache with the given interval until the context is done.
+// See Resync for more details.
+func (s *ToolchainClusterService) StartPeriodicResync(ctx context.Context, interval time.Duration) {
+	s.log.Info("starting periodic resync of the cluster cache", "interval", interval)
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := s.Resync(ctx); err != nil {
+			s.log.Error(err, "the cluster cache was not resynced")
+		}
+	}, interval)
+}
+
+// Resync lists all ToolchainClusters and updates the cache so it reflects them - the clients of the clusters whose
+// config has changed (eg. because the token in the Secret was rotated or the CA bundle was changed) are rebuilt,
+// and the clusters whose ToolchainCluster doesn't exist anymore are removed from the cache.
+// The time of the last successful resync is available via ClusterCache.LastResyncTime.
+func (s *ToolchainClusterService) Resync(ctx context.Context) error {
+	defer observeRefresh(resyncOperation, time.Now())
+	toolchainClusters := &toolchainv1alpha1.ToolchainClusterList{}
+	if err := s.client.List(ctx, toolchainClusters, client.InNamespace(s.namespace)); err != nil {
+		return errors.Wrap(err, "unable to list ToolchainClusters")
+	}
+	existing := make(map[string]bool, len(toolchainClusters.Items))
+	for i := range toolchainClusters.Items {
+		cluster := toolchainClusters.Items[i] // avoids the `G601: Implicit memory aliasing in for loop` problem
+		existing[cluster.Name] = true
+		log := s.enrichLogger(&cluster)
+		if err := s.addToolchainCluster(log, &cluster); err != nil {
+			// keep the previously cached cluster (if any), the next resync will try it again
+			log.Error(err, "the cluster was not resynced")
+		}
+	}
+	for _, name := range s.cache.deleteCachedToolchainClustersExcept(existing) {
+		s.log.Info("removed the cluster from the cache because the ToolchainCluster doesn't exist anymore", "Request.Name", name)
+	}
+	s.cache.setLastResyncTime(time.Now())
+	return nil
 }
 
 func (s *ToolchainClusterService) refreshCache() {
@@ -168,67 +276,160 @@ func (s *ToolchainClusterService) enrichLogger(cluster *toolchainv1alpha1.Toolch
 }
 
 // NewClusterConfig generate a new cluster config by fetching the necessary info the given ToolchainCluster's associated Secret and taking all data from ToolchainCluster CR
+// The Secret has to contain one of the following credentials:
+//   - a whole kubeconfig under the "kubeconfig" key (its server is overridden by the API endpoint of the ToolchainCluster)
+//   - a bearer token under the "token" key
+//   - a client certificate and its private key under the "tls.crt" and "tls.key" keys
+//
+// The TLS verification of the cluster's certificate is disabled only when the ToolchainCluster explicitly opts in
+// by having "*" in the list of disabled TLS validations (the "insecure-skip-tls-verify" setting of the kubeconfig is ignored).
 func NewClusterConfig(cl client.Client, toolchainCluster *toolchainv1alpha1.ToolchainCluster, timeout time.Duration) (*Config, error) {
+	return NewClusterConfigWithClientSettings(cl, toolchainCluster, DefaultClientSettings(timeout))
+}
+
+// NewClusterConfigWithClientSettings generates a new cluster config the same way as NewClusterConfig does, but the client settings
+// are taken from the given defaults unless they are overridden by the annotations of the ToolchainCluster
+func NewClusterConfigWithClientSettings(cl client.Client, toolchainCluster *toolchainv1alpha1.ToolchainCluster, defaults ClientSettings) (*Config, error) {
 	clusterName := toolchainCluster.Name
 
 	apiEndpoint := toolchainCluster.Spec.APIEndpoint
 	if apiEndpoint == "" {
-		return nil, errors.Errorf("the api endpoint of cluster %s is empty", clusterName)
+		return nil, newConfigurationError(InvalidAPIEndpointReason, errors.Errorf("the api endpoint of cluster %s is empty", clusterName))
 	}
 
 	secretName := toolchainCluster.Spec.SecretRef.Name
 	if secretName == "" {
-		return nil, errors.Errorf("cluster %s does not have a secret name", clusterName)
+		return nil, newConfigurationError(SecretNotFoundReason, errors.Errorf("cluster %s does not have a secret name", clusterName))
 	}
-	secret := &v1.Secret{}
+	secret := &corev1.Secret{}
 	name := types.NamespacedName{
 		Namespace: toolchainCluster.Namespace,
 		Name:      secretName,
 	}
 	err := cl.Get(context.TODO(), name, secret)
 	if err != nil {
-		return nil, errors.Wrapf(err, "unable to get secret %s for cluster %s", name, clusterName)
-	}
-
-	token, tokenFound := secret.Data[toolchainTokenKey]
-	if !tokenFound || len(token) == 0 {
-		return nil, errors.Errorf("the secret for cluster %s is missing a non-empty value for %q", clusterName, toolchainTokenKey)
+		err = errors.Wrapf(err, "unable to get secret %s for cluster %s", name, clusterName)
+		if apierrors.IsNotFound(err) {
+			return nil, newConfigurationError(SecretNotFoundReason, err)
+		}
+		return nil, err
 	}
 
-	restConfig, err := clientcmd.BuildConfigFromFlags(apiEndpoint, "")
+	clientSettings := clientSettingsFor(toolchainCluster, defaults)
+	restConfig, err := newRestConfig(toolchainCluster, secret)
 	if err != nil {
 		return nil, err
 	}
-
-	if toolchainCluster.Spec.CABundle != "" {
-		ca, err := base64.StdEncoding.DecodeString(toolchainCluster.Spec.CABundle)
-		if err != nil {
-			return nil, err
-		}
-		restConfig.CAData = ca
-	} else {
-		restConfig.Insecure = true
+	restConfig.QPS = clientSettings.QPS
+	restConfig.Burst = clientSettings.Burst
+	restConfig.Timeout = clientSettings.Timeout
+	if clientSettings.UserAgent != "" {
+		restConfig.UserAgent = clientSettings.UserAgent
 	}
-	restConfig.BearerToken = string(token)
-	restConfig.QPS = toolchainAPIQPS
-	restConfig.Burst = toolchainAPIBurst
-	restConfig.Timeout = timeout
 
 	return &Config{
 		Name:              toolchainCluster.Name,
+		Namespace:         toolchainCluster.Namespace,
 		APIEndpoint:       toolchainCluster.Spec.APIEndpoint,
 		RestConfig:        restConfig,
 		Type:              Type(toolchainCluster.Labels[LabelType]),
 		OperatorNamespace: toolchainCluster.Labels[labelNamespace],
 		OwnerClusterName:  toolchainCluster.Labels[labelOwnerClusterName],
 		Labels:            toolchainCluster.Labels,
+		ClientSettings:    clientSettings,
 	}, nil
 }
 
+func newRestConfig(toolchainCluster *toolchainv1alpha1.ToolchainCluster, secret *corev1.Secret) (*rest.Config, error) {
+	clusterName := toolchainCluster.Name
+	restConfig, err := newRestConfigWithCredentials(toolchainCluster, secret)
+	if err != nil {
+		return nil, newConfigurationError(InvalidCredentialsReason, err)
+	}
+
+	if toolchainCluster.Spec.CABundle != "" {
+		ca, err := base64.StdEncoding.DecodeString(toolchainCluster.Spec.CABundle)
+		if err != nil {
+			return nil, newConfigurationError(InvalidCABundleReason, errors.Wrapf(err, "the CA bundle of cluster %s is not a valid base64 value", clusterName))
+		}
+		restConfig.CAData = ca
+		restConfig.CAFile = ""
+	}
+	if IsInsecure(toolchainCluster) {
+		restConfig.Insecure = true
+		// the client refuses to be configured as insecure with root certificates
+		restConfig.CAData = nil
+		restConfig.CAFile = ""
+	} else {
+		// the kubeconfig cannot bypass the explicit opt-in of the ToolchainCluster
+		restConfig.Insecure = false
+	}
+	return restConfig, nil
+}
+
+// newRestConfigWithCredentials returns the config of the client of the given cluster with the credentials taken from the given secret
+func newRestConfigWithCredentials(toolchainCluster *toolchainv1alpha1.ToolchainCluster, secret *corev1.Secret) (*rest.Config, error) {
+	clusterName := toolchainCluster.Name
+	var restConfig *rest.Config
+	if kubeconfig, found := secret.Data[toolchainKubeconfigKey]; found {
+		if len(kubeconfig) == 0 {
+			return nil, errors.Errorf("the secret for cluster %s contains an empty value for %q", clusterName, toolchainKubeconfigKey)
+		}
+		var err error
+		restConfig, err = clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+		if err != nil {
+			return nil, errors.Wrapf(err, "the secret for cluster %s contains a malformed value for %q", clusterName, toolchainKubeconfigKey)
+		}
+		restConfig.Host = toolchainCluster.Spec.APIEndpoint
+	} else {
+		var err error
+		restConfig, err = clientcmd.BuildConfigFromFlags(toolchainCluster.Spec.APIEndpoint, "")
+		if err != nil {
+			return nil, err
+		}
+		token, tokenFound := secret.Data[ToolchainTokenKey]
+		cert, certFound := secret.Data[toolchainClientCertKey]
+		key, keyFound := secret.Data[toolchainClientKeyKey]
+		switch {
+		case tokenFound:
+			if len(token) == 0 {
+				return nil, errors.Errorf("the secret for cluster %s is missing a non-empty value for %q", clusterName, ToolchainTokenKey)
+			}
+			restConfig.BearerToken = string(token)
+		case certFound || keyFound:
+			if len(cert) == 0 {
+				return nil, errors.Errorf("the secret for cluster %s is missing a non-empty value for %q", clusterName, toolchainClientCertKey)
+			}
+			if len(key) == 0 {
+				return nil, errors.Errorf("the secret for cluster %s is missing a non-empty value for %q", clusterName, toolchainClientKeyKey)
+			}
+			if _, err := tls.X509KeyPair(cert, key); err != nil {
+				return nil, errors.Wrapf(err, "the secret for cluster %s contains a malformed client certificate in %q and %q", clusterName, toolchainClientCertKey, toolchainClientKeyKey)
+			}
+			restConfig.CertData = cert
+			restConfig.KeyData = key
+		default:
+			return nil, errors.Errorf("the secret for cluster %s is missing a non-empty value for %q (or %q, or %q and %q)",
+				clusterName, ToolchainTokenKey, toolchainKubeconfigKey, toolchainClientCertKey, toolchainClientKeyKey)
+		}
+	}
+	return restConfig, nil
+}
+
+// IsInsecure returns true if the given ToolchainCluster explicitly opts in for disabling all the TLS validations
+func IsInsecure(toolchainCluster *toolchainv1alpha1.ToolchainCluster) bool {
+	for _, validation := range toolchainCluster.Spec.DisabledTLSValidations {
+		if validation == toolchainv1alpha1.TLSAll {
+			return true
+		}
+	}
+	return false
+}
+
 func IsReady(clusterStatus *toolchainv1alpha1.ToolchainClusterStatus) bool {
 	for _, condition := range clusterStatus.Conditions {
 		if condition.Type == toolchainv1alpha1.ToolchainClusterReady {
-			if condition.Status == v1.ConditionTrue {
+			if condition.Status == corev1.ConditionTrue {
 				return true
 			}
 		}
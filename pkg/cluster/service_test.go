@@ -2,7 +2,14 @@ package cluster_test
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"math/big"
 	"testing"
 	"time"
 
@@ -10,6 +17,7 @@ import (
 	"github.com/codeready-toolchain/toolchain-common/pkg/cluster"
 	"github.com/codeready-toolchain/toolchain-common/pkg/test"
 	"github.com/codeready-toolchain/toolchain-common/pkg/test/verify"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -159,3 +167,279 @@ func TestListToolchainClusterConfigs(t *testing.T) {
 		require.Len(t, clusterConfigs, 0)
 	})
 }
+
+func TestNewClusterConfigCredentials(t *testing.T) {
+	// given
+	require.NoError(t, toolchainv1alpha1.AddToScheme(scheme.Scheme))
+	status := test.NewClusterStatus(toolchainv1alpha1.ToolchainClusterReady, corev1.ConditionTrue)
+	cert, key := newClientCertificate(t)
+
+	newClusterConfig := func(t *testing.T, data map[string][]byte, modify ...func(*toolchainv1alpha1.ToolchainCluster)) (*cluster.Config, error) {
+		toolchainCluster, secret := test.NewToolchainCluster("east", "secret", status, verify.Labels(cluster.Member, "", test.NameHost))
+		for _, m := range modify {
+			m(toolchainCluster)
+		}
+		secret.Data = data
+		cl := test.NewFakeClient(t, toolchainCluster, secret)
+		return cluster.NewClusterConfig(cl, toolchainCluster, time.Second)
+	}
+
+	t.Run("token", func(t *testing.T) {
+		// when
+		config, err := newClusterConfig(t, map[string][]byte{"token": []byte("mycooltoken")})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "mycooltoken", config.RestConfig.BearerToken)
+		assert.False(t, config.RestConfig.Insecure)
+	})
+
+	t.Run("client certificate", func(t *testing.T) {
+		// when
+		config, err := newClusterConfig(t, map[string][]byte{"tls.crt": cert, "tls.key": key})
+
+		// then
+		require.NoError(t, err)
+		assert.Empty(t, config.RestConfig.BearerToken)
+		assert.Equal(t, cert, config.RestConfig.CertData)
+		assert.Equal(t, key, config.RestConfig.KeyData)
+	})
+
+	t.Run("kubeconfig", func(t *testing.T) {
+		// given
+		kubeconfig := `apiVersion: v1
+kind: Config
+clusters:
+- name: east
+  cluster:
+    server: https://some-other-server.com
+contexts:
+- name: east
+  context:
+    cluster: east
+    user: east-user
+current-context: east
+users:
+- name: east-user
+  user:
+    token: kubeconfig-token
+`
+
+		// when
+		config, err := newClusterConfig(t, map[string][]byte{"kubeconfig": []byte(kubeconfig)}, func(toolchainCluster *toolchainv1alpha1.ToolchainCluster) {
+			toolchainCluster.Spec.CABundle = "ZHVtbXk="
+		})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "kubeconfig-token", config.RestConfig.BearerToken)
+		assert.Equal(t, "http://cluster.com", config.RestConfig.Host)
+		assert.Equal(t, []byte("dummy"), config.RestConfig.CAData)
+	})
+
+	t.Run("insecure kubeconfig without explicit opt-in", func(t *testing.T) {
+		// given
+		kubeconfig := `apiVersion: v1
+kind: Config
+clusters:
+- name: east
+  cluster:
+    server: https://some-other-server.com
+    insecure-skip-tls-verify: true
+contexts:
+- name: east
+  context:
+    cluster: east
+    user: east-user
+current-context: east
+users:
+- name: east-user
+  user:
+    token: kubeconfig-token
+`
+
+		// when
+		config, err := newClusterConfig(t, map[string][]byte{"kubeconfig": []byte(kubeconfig)})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "kubeconfig-token", config.RestConfig.BearerToken)
+		assert.False(t, config.RestConfig.Insecure)
+	})
+
+	t.Run("explicit insecure opt-in", func(t *testing.T) {
+		// when
+		config, err := newClusterConfig(t, map[string][]byte{"token": []byte("mycooltoken")}, func(toolchainCluster *toolchainv1alpha1.ToolchainCluster) {
+			toolchainCluster.Spec.CABundle = "ZHVtbXk="
+			toolchainCluster.Spec.DisabledTLSValidations = []toolchainv1alpha1.TLSValidation{toolchainv1alpha1.TLSAll}
+		})
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, config.RestConfig.Insecure)
+		assert.Empty(t, config.RestConfig.CAData)
+	})
+
+	t.Run("failures", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			data     map[string][]byte
+			caBundle string
+			errMsg   string
+		}{
+			"no credentials": {
+				data:   map[string][]byte{},
+				errMsg: `the secret for cluster east is missing a non-empty value for "token" (or "kubeconfig", or "tls.crt" and "tls.key")`,
+			},
+			"empty token": {
+				data:   map[string][]byte{"token": {}},
+				errMsg: `the secret for cluster east is missing a non-empty value for "token"`,
+			},
+			"empty kubeconfig": {
+				data:   map[string][]byte{"kubeconfig": {}},
+				errMsg: `the secret for cluster east contains an empty value for "kubeconfig"`,
+			},
+			"malformed kubeconfig": {
+				data:   map[string][]byte{"kubeconfig": []byte("{not a kubeconfig")},
+				errMsg: `the secret for cluster east contains a malformed value for "kubeconfig"`,
+			},
+			"missing client key": {
+				data:   map[string][]byte{"tls.crt": cert},
+				errMsg: `the secret for cluster east is missing a non-empty value for "tls.key"`,
+			},
+			"missing client certificate": {
+				data:   map[string][]byte{"tls.key": key},
+				errMsg: `the secret for cluster east is missing a non-empty value for "tls.crt"`,
+			},
+			"malformed client certificate": {
+				data:   map[string][]byte{"tls.crt": []byte("cert"), "tls.key": key},
+				errMsg: `the secret for cluster east contains a malformed client certificate in "tls.crt" and "tls.key"`,
+			},
+			"malformed CA bundle": {
+				data:     map[string][]byte{"token": []byte("mycooltoken")},
+				caBundle: "not-base64!",
+				errMsg:   `the CA bundle of cluster east is not a valid base64 value`,
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				// when
+				_, err := newClusterConfig(t, tc.data, func(toolchainCluster *toolchainv1alpha1.ToolchainCluster) {
+					toolchainCluster.Spec.CABundle = tc.caBundle
+				})
+
+				// then
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errMsg)
+			})
+		}
+	})
+}
+
+func TestNewClusterConfigClientSettings(t *testing.T) {
+	// given
+	require.NoError(t, toolchainv1alpha1.AddToScheme(scheme.Scheme))
+	status := test.NewClusterStatus(toolchainv1alpha1.ToolchainClusterReady, corev1.ConditionTrue)
+	defaults := cluster.ClientSettings{
+		QPS:       50,
+		Burst:     60,
+		Timeout:   5 * time.Second,
+		UserAgent: "toolchain-default",
+	}
+
+	newClusterConfig := func(t *testing.T, annotations map[string]string) (*cluster.Config, error) {
+		toolchainCluster, secret := test.NewToolchainCluster("east", "secret", status, verify.Labels(cluster.Member, "", test.NameHost))
+		toolchainCluster.Annotations = annotations
+		cl := test.NewFakeClient(t, toolchainCluster, secret)
+		return cluster.NewClusterConfigWithClientSettings(cl, toolchainCluster, defaults)
+	}
+
+	t.Run("built-in defaults", func(t *testing.T) {
+		// given
+		toolchainCluster, secret := test.NewToolchainCluster("east", "secret", status, verify.Labels(cluster.Member, "", test.NameHost))
+		cl := test.NewFakeClient(t, toolchainCluster, secret)
+
+		// when
+		config, err := cluster.NewClusterConfig(cl, toolchainCluster, 3*time.Second)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, cluster.ClientSettings{QPS: 20, Burst: 30, Timeout: 3 * time.Second}, config.ClientSettings)
+		assert.Equal(t, float32(20), config.RestConfig.QPS)
+		assert.Equal(t, 30, config.RestConfig.Burst)
+		assert.Equal(t, 3*time.Second, config.RestConfig.Timeout)
+	})
+
+	t.Run("given defaults", func(t *testing.T) {
+		// when
+		config, err := newClusterConfig(t, nil)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, defaults, config.ClientSettings)
+		assert.Equal(t, float32(50), config.RestConfig.QPS)
+		assert.Equal(t, 60, config.RestConfig.Burst)
+		assert.Equal(t, 5*time.Second, config.RestConfig.Timeout)
+		assert.Equal(t, "toolchain-default", config.RestConfig.UserAgent)
+	})
+
+	t.Run("overridden by annotations", func(t *testing.T) {
+		// when
+		config, err := newClusterConfig(t, map[string]string{
+			cluster.QPSAnnotationKey:       "100.5",
+			cluster.BurstAnnotationKey:     "200",
+			cluster.TimeoutAnnotationKey:   "10s",
+			cluster.UserAgentAnnotationKey: "toolchain-east",
+		})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, cluster.ClientSettings{QPS: 100.5, Burst: 200, Timeout: 10 * time.Second, UserAgent: "toolchain-east"}, config.ClientSettings)
+		assert.Equal(t, float32(100.5), config.RestConfig.QPS)
+		assert.Equal(t, 200, config.RestConfig.Burst)
+		assert.Equal(t, 10*time.Second, config.RestConfig.Timeout)
+		assert.Equal(t, "toolchain-east", config.RestConfig.UserAgent)
+	})
+
+	t.Run("partially overridden by annotations", func(t *testing.T) {
+		// when
+		config, err := newClusterConfig(t, map[string]string{
+			cluster.BurstAnnotationKey: "200",
+		})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, cluster.ClientSettings{QPS: 50, Burst: 200, Timeout: 5 * time.Second, UserAgent: "toolchain-default"}, config.ClientSettings)
+	})
+
+	t.Run("invalid annotations fall back to defaults", func(t *testing.T) {
+		// when
+		config, err := newClusterConfig(t, map[string]string{
+			cluster.QPSAnnotationKey:       "fast",
+			cluster.BurstAnnotationKey:     "-1",
+			cluster.TimeoutAnnotationKey:   "10",
+			cluster.UserAgentAnnotationKey: "toolchain-east",
+		})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, cluster.ClientSettings{QPS: 50, Burst: 60, Timeout: 5 * time.Second, UserAgent: "toolchain-east"}, config.ClientSettings)
+	})
+}
+
+func newClientCertificate(t *testing.T) ([]byte, []byte) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "toolchain"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(privateKey)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
@@ -1,6 +1,10 @@
 package cluster
 
 import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -10,6 +14,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"gopkg.in/h2non/gock.v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -124,6 +129,230 @@ func TestUpdateClientBasedOnRestConfig(t *testing.T) {
 	})
 }
 
+func TestServicesWithDifferentCaches(t *testing.T) {
+	// given
+	defer gock.Off()
+	status := test.NewClusterStatus(toolchainv1alpha1.ToolchainClusterReady, corev1.ConditionTrue)
+	east, eastSecret := test.NewToolchainCluster("east", "secret-east", status, map[string]string{"type": string(Member)})
+	west, westSecret := test.NewToolchainCluster("west", "secret-west", status, map[string]string{"type": string(Member)})
+	cl := test.NewFakeClient(t, eastSecret, westSecret)
+	newClient := func(config *rest.Config, options client.Options) (client.Client, error) {
+		return test.NewFakeClient(t), nil
+	}
+	eastCache := NewClusterCache()
+	eastService := NewToolchainClusterServiceWithCache(eastCache, cl, logf.Log, "test-namespace", 0, newClient)
+	westCache := NewClusterCache()
+	westService := NewToolchainClusterServiceWithCache(westCache, cl, logf.Log, "test-namespace", 0, newClient)
+
+	// when
+	err := eastService.AddOrUpdateToolchainCluster(east)
+	require.NoError(t, err)
+	err = westService.AddOrUpdateToolchainCluster(west)
+	require.NoError(t, err)
+
+	// then
+	assert.Same(t, eastCache, eastService.Cache())
+	assert.Same(t, westCache, westService.Cache())
+	_, ok := eastCache.getCachedToolchainCluster("east", false)
+	assert.True(t, ok)
+	_, ok = eastCache.getCachedToolchainCluster("west", false)
+	assert.False(t, ok)
+	_, ok = westCache.getCachedToolchainCluster("west", false)
+	assert.True(t, ok)
+	_, ok = westCache.getCachedToolchainCluster("east", false)
+	assert.False(t, ok)
+	_, ok = clusterCache.getCachedToolchainCluster("east", false)
+	assert.False(t, ok)
+}
+
+func TestServiceWithDefaultClientSettings(t *testing.T) {
+	// given
+	status := test.NewClusterStatus(toolchainv1alpha1.ToolchainClusterReady, corev1.ConditionTrue)
+	east, eastSecret := test.NewToolchainCluster("east", "secret-east", status, map[string]string{"type": string(Member)})
+	west, westSecret := test.NewToolchainCluster("west", "secret-west", status, map[string]string{"type": string(Member)})
+	west.Annotations = map[string]string{QPSAnnotationKey: "5"}
+	cl := test.NewFakeClient(t, eastSecret, westSecret)
+	cache := NewClusterCache()
+	service := NewToolchainClusterServiceWithCache(cache, cl, logf.Log, "test-namespace", 3*time.Second, func(config *rest.Config, options client.Options) (client.Client, error) {
+		return test.NewFakeClient(t), nil
+	}, WithDefaultClientSettings(ClientSettings{QPS: 40, UserAgent: "toolchain"}))
+
+	// when
+	require.NoError(t, service.AddOrUpdateToolchainCluster(east))
+	require.NoError(t, service.AddOrUpdateToolchainCluster(west))
+
+	// then
+	cachedEast, ok := cache.getCachedToolchainCluster("east", false)
+	require.True(t, ok)
+	assert.Equal(t, ClientSettings{QPS: 40, Burst: 30, Timeout: 3 * time.Second, UserAgent: "toolchain"}, cachedEast.ClientSettings)
+	cachedWest, ok := cache.getCachedToolchainCluster("west", false)
+	require.True(t, ok)
+	assert.Equal(t, ClientSettings{QPS: 5, Burst: 30, Timeout: 3 * time.Second, UserAgent: "toolchain"}, cachedWest.ClientSettings)
+	assert.Equal(t, float32(5), cachedWest.RestConfig.QPS)
+}
+
+func TestResync(t *testing.T) {
+	// given
+	status := test.NewClusterStatus(toolchainv1alpha1.ToolchainClusterReady, corev1.ConditionTrue)
+	east, eastSecret := test.NewToolchainCluster("east", "secret-east", status, map[string]string{"type": string(Member)})
+	newClient := func(config *rest.Config, options client.Options) (client.Client, error) {
+		return test.NewFakeClient(t), nil
+	}
+
+	t.Run("rebuilds changed clients and evicts removed clusters", func(t *testing.T) {
+		// given
+		cl := test.NewFakeClient(t, east, eastSecret)
+		cache := NewClusterCache()
+		service := NewToolchainClusterServiceWithCache(cache, cl, logf.Log, "test-namespace", 0, newClient)
+		require.NoError(t, service.AddOrUpdateToolchainCluster(east))
+		originalClient := cache.clusters["east"].Client
+		originalClientset := cache.clusters["east"].Clientset
+		cache.addCachedToolchainCluster(newTestCachedToolchainCluster(t, "gone", Member, ready))
+		// rotate the token
+		eastSecret.Data["token"] = []byte("rotated-token")
+		require.NoError(t, cl.Update(context.TODO(), eastSecret))
+		before := time.Now()
+
+		// when
+		err := service.Resync(context.TODO())
+
+		// then
+		require.NoError(t, err)
+		require.Len(t, cache.clusters, 1)
+		cachedEast, ok := cache.getCachedToolchainCluster("east", false)
+		require.True(t, ok)
+		assert.Equal(t, "rotated-token", cachedEast.RestConfig.BearerToken)
+		assert.NotSame(t, originalClient, cachedEast.Client)
+		require.NotNil(t, cachedEast.Clientset)
+		assert.NotSame(t, originalClientset, cachedEast.Clientset)
+		assert.False(t, cache.LastResyncTime().Before(before))
+	})
+
+	t.Run("keeps the clients when nothing changed", func(t *testing.T) {
+		// given
+		cl := test.NewFakeClient(t, east, eastSecret)
+		cache := NewClusterCache()
+		service := NewToolchainClusterServiceWithCache(cache, cl, logf.Log, "test-namespace", 0, newClient)
+		require.NoError(t, service.AddOrUpdateToolchainCluster(east))
+		originalClient := cache.clusters["east"].Client
+		originalClientset := cache.clusters["east"].Clientset
+
+		// when
+		err := service.Resync(context.TODO())
+
+		// then
+		require.NoError(t, err)
+		cachedEast, ok := cache.getCachedToolchainCluster("east", false)
+		require.True(t, ok)
+		assert.Same(t, originalClient, cachedEast.Client)
+		require.NotNil(t, cachedEast.Clientset)
+		assert.Same(t, originalClientset, cachedEast.Clientset)
+	})
+
+	t.Run("fails when list fails", func(t *testing.T) {
+		// given
+		cl := test.NewFakeClient(t, east, eastSecret)
+		cl.MockList = func(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+			return fmt.Errorf("some error")
+		}
+		cache := NewClusterCache()
+		service := NewToolchainClusterServiceWithCache(cache, cl, logf.Log, "test-namespace", 0, newClient)
+		cache.addCachedToolchainCluster(newTestCachedToolchainCluster(t, "east", Member, ready))
+
+		// when
+		err := service.Resync(context.TODO())
+
+		// then
+		require.EqualError(t, err, "unable to list ToolchainClusters: some error")
+		assert.Len(t, cache.clusters, 1)
+		assert.True(t, cache.LastResyncTime().IsZero())
+	})
+
+	t.Run("periodic resync", func(t *testing.T) {
+		// given
+		cl := test.NewFakeClient(t, east, eastSecret)
+		cache := NewClusterCache()
+		service := NewToolchainClusterServiceWithCache(cache, cl, logf.Log, "test-namespace", 0, newClient)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// when
+		service.StartPeriodicResync(ctx, 10*time.Millisecond)
+
+		// then
+		require.Eventually(t, func() bool {
+			_, ok := cache.getCachedToolchainCluster("east", false)
+			return ok && !cache.LastResyncTime().IsZero()
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestNumberOfListCallsForConcurrentLookups(t *testing.T) {
+	// given
+	status := test.NewClusterStatus(toolchainv1alpha1.ToolchainClusterReady, corev1.ConditionTrue)
+	east, eastSecret := test.NewToolchainCluster("east", "secret-east", status, map[string]string{"type": string(Member)})
+
+	for _, tc := range []struct {
+		name             string
+		negativeCacheTTL time.Duration
+		lookedUpName     string
+		rounds           int
+		maxListCalls     int32
+	}{
+		{name: "existing cluster", lookedUpName: "east", rounds: 3, maxListCalls: 2},
+		{name: "non-existing cluster without negative cache", lookedUpName: "unknown", rounds: 3, maxListCalls: 6},
+		{name: "non-existing cluster with negative cache", lookedUpName: "unknown", negativeCacheTTL: time.Hour, rounds: 3, maxListCalls: 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// when
+			listCalls := countListCallsForConcurrentLookups(t, tc.negativeCacheTTL, tc.lookedUpName, 100, tc.rounds, east, eastSecret)
+
+			// then
+			t.Logf("%d rounds of 100 concurrent lookups of '%s' resulted in %d List calls", tc.rounds, tc.lookedUpName, listCalls)
+			assert.LessOrEqual(t, listCalls, tc.maxListCalls)
+		})
+	}
+}
+
+func BenchmarkConcurrentLookups(b *testing.B) {
+	status := test.NewClusterStatus(toolchainv1alpha1.ToolchainClusterReady, corev1.ConditionTrue)
+	east, eastSecret := test.NewToolchainCluster("east", "secret-east", status, map[string]string{"type": string(Member)})
+	for i := 0; i < b.N; i++ {
+		listCalls := countListCallsForConcurrentLookups(b, 0, "unknown", 100, 1, east, eastSecret)
+		b.ReportMetric(float64(listCalls), "lists/op")
+	}
+}
+
+// countListCallsForConcurrentLookups runs the given number of rounds of concurrent lookups of the given name in a new cache
+// and returns the number of List calls triggered by the cache refreshes
+func countListCallsForConcurrentLookups(t test.T, negativeCacheTTL time.Duration, name string, concurrency, rounds int, initObjs ...runtime.Object) int32 {
+	var listCalls int32
+	cl := test.NewFakeClient(t, initObjs...)
+	cl.MockList = func(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+		atomic.AddInt32(&listCalls, 1)
+		// make the refresh slow enough so the lookups really overlap
+		time.Sleep(10 * time.Millisecond)
+		return cl.Client.List(ctx, list, opts...)
+	}
+	cache := NewClusterCache(WithNegativeCacheTTL(negativeCacheTTL))
+	NewToolchainClusterServiceWithCache(cache, cl, logf.Log, "test-namespace", 0, func(config *rest.Config, options client.Options) (client.Client, error) {
+		return test.NewFakeClient(t), nil
+	})
+
+	for round := 0; round < rounds; round++ {
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				cache.GetCachedToolchainCluster(name)
+			}()
+		}
+		wg.Wait()
+	}
+	return atomic.LoadInt32(&listCalls)
+}
+
 func newToolchainClusterService(cl client.Client, timeout time.Duration) ToolchainClusterService {
 	return NewToolchainClusterServiceWithClient(cl, logf.Log, "test-namespace", timeout, func(config *rest.Config, options client.Options) (client.Client, error) {
 		// make sure that insecure is false to make Gock mocking working properly
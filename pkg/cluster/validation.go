@@ -0,0 +1,163 @@
+package cluster
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var supportedTLSValidations = []string{
+	string(toolchainv1alpha1.TLSAll),
+	string(toolchainv1alpha1.TLSSubjectName),
+	string(toolchainv1alpha1.TLSValidityPeriod),
+}
+
+// ValidateToolchainCluster validates the given ToolchainCluster and returns all the problems that were found:
+// the format of the API endpoint, the consistency of the labels, the CA bundle, the annotations overriding the client
+// settings, and the contents of the Secret with the credentials.
+// The Secret is verified only if the given client is not nil, so the function can be used also in places where
+// the Secret cannot be read (eg. in a validating admission webhook).
+// An empty list means that the ToolchainCluster is valid.
+func ValidateToolchainCluster(ctx context.Context, cl client.Client, toolchainCluster *toolchainv1alpha1.ToolchainCluster) field.ErrorList {
+	allErrs := field.ErrorList{}
+	allErrs = append(allErrs, validateLabels(toolchainCluster, field.NewPath("metadata", "labels"))...)
+	allErrs = append(allErrs, validateAnnotations(toolchainCluster, field.NewPath("metadata", "annotations"))...)
+	allErrs = append(allErrs, validateSpec(ctx, cl, toolchainCluster, field.NewPath("spec"))...)
+	return allErrs
+}
+
+func validateLabels(toolchainCluster *toolchainv1alpha1.ToolchainCluster, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	labels := toolchainCluster.Labels
+
+	clusterType, typeFound := labels[LabelType]
+	// an empty type is handled the same way as a missing label
+	if typeFound && clusterType != "" && clusterType != string(Host) && clusterType != string(Member) {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Key(LabelType), clusterType, []string{string(Host), string(Member)}))
+	}
+	if clusterType == "" {
+		// the same default as the one used by the ToolchainClusterService
+		clusterType = string(Member)
+	}
+	// the cluster roles are used only for the member clusters
+	if clusterType != string(Member) {
+		for key := range labels {
+			if strings.HasPrefix(key, RoleLabel("")) {
+				allErrs = append(allErrs, field.Forbidden(fldPath.Key(key), fmt.Sprintf("the cluster roles can be set only when the label %q is %q", LabelType, Member)))
+			}
+		}
+	}
+	if namespace, found := labels[labelNamespace]; found {
+		for _, msg := range validation.IsDNS1123Label(namespace) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Key(labelNamespace), namespace, msg))
+		}
+	}
+	if ownerClusterName := labels[labelOwnerClusterName]; ownerClusterName != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(ownerClusterName) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Key(labelOwnerClusterName), ownerClusterName, msg))
+		}
+	}
+	return allErrs
+}
+
+func validateAnnotations(toolchainCluster *toolchainv1alpha1.ToolchainCluster, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for _, annotation := range clientSettingAnnotations {
+		settings := ClientSettings{}
+		if value, found := toolchainCluster.Annotations[annotation.key]; found && !annotation.apply(&settings, value) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Key(annotation.key), value, "must be "+annotation.requirement))
+		}
+	}
+	return allErrs
+}
+
+func validateSpec(ctx context.Context, cl client.Client, toolchainCluster *toolchainv1alpha1.ToolchainCluster, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	spec := toolchainCluster.Spec
+
+	if spec.APIEndpoint == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("apiEndpoint"), ""))
+	} else if msg := validateAPIEndpoint(spec.APIEndpoint); msg != "" {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("apiEndpoint"), spec.APIEndpoint, msg))
+	}
+
+	if spec.CABundle != "" {
+		if _, err := base64.StdEncoding.DecodeString(spec.CABundle); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("caBundle"), "<redacted>", "must be a valid base64 value"))
+		}
+	}
+
+	for i, disabled := range spec.DisabledTLSValidations {
+		idxPath := fldPath.Child("disabledTLSValidations").Index(i)
+		switch {
+		case !contains(supportedTLSValidations, string(disabled)):
+			allErrs = append(allErrs, field.NotSupported(idxPath, disabled, supportedTLSValidations))
+		case disabled == toolchainv1alpha1.TLSAll && len(spec.DisabledTLSValidations) > 1:
+			allErrs = append(allErrs, field.Invalid(idxPath, disabled, fmt.Sprintf("%q must be the only value when set", toolchainv1alpha1.TLSAll)))
+		}
+	}
+
+	secretPath := fldPath.Child("secretRef", "name")
+	if spec.SecretRef.Name == "" {
+		allErrs = append(allErrs, field.Required(secretPath, ""))
+	} else if cl != nil {
+		allErrs = append(allErrs, validateSecret(ctx, cl, toolchainCluster, secretPath)...)
+	}
+	return allErrs
+}
+
+// validateAPIEndpoint returns a message describing the problem of the given endpoint, or an empty string if the endpoint is valid.
+// The endpoint can be either a URL with the http or https scheme, or a host with an optional port (then https is used).
+func validateAPIEndpoint(apiEndpoint string) string {
+	if !strings.Contains(apiEndpoint, "://") {
+		apiEndpoint = "https://" + apiEndpoint
+	}
+	endpointURL, err := url.Parse(apiEndpoint)
+	if err != nil {
+		return fmt.Sprintf("must be a valid URL: %s", err)
+	}
+	if endpointURL.Scheme != "http" && endpointURL.Scheme != "https" {
+		return fmt.Sprintf("must use the http or https scheme, but was %q", endpointURL.Scheme)
+	}
+	if endpointURL.Hostname() == "" {
+		return "must contain a host"
+	}
+	return ""
+}
+
+func validateSecret(ctx context.Context, cl client.Client, toolchainCluster *toolchainv1alpha1.ToolchainCluster, fldPath *field.Path) field.ErrorList {
+	secret := &corev1.Secret{}
+	name := types.NamespacedName{
+		Namespace: toolchainCluster.Namespace,
+		Name:      toolchainCluster.Spec.SecretRef.Name,
+	}
+	if err := cl.Get(ctx, name, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return field.ErrorList{field.NotFound(fldPath, name.Name)}
+		}
+		return field.ErrorList{field.InternalError(fldPath, err)}
+	}
+	if _, err := newRestConfigWithCredentials(toolchainCluster, secret); err != nil {
+		return field.ErrorList{field.Invalid(fldPath, name.Name, err.Error())}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
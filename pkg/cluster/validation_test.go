@@ -0,0 +1,165 @@
+package cluster_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/toolchain-common/pkg/cluster"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test/verify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestValidateToolchainCluster(t *testing.T) {
+	// given
+	status := test.NewClusterStatus(toolchainv1alpha1.ToolchainClusterReady, corev1.ConditionTrue)
+
+	t.Run("valid", func(t *testing.T) {
+		for _, endpoint := range []string{"http://cluster.com", "https://api.cluster.com:6443", "api.cluster.com:6443"} {
+			t.Run(endpoint, func(t *testing.T) {
+				// given
+				toolchainCluster, secret := test.NewToolchainClusterWithEndpoint("east", "secret", endpoint, status, verify.Labels(cluster.Member, "member-ns", test.NameHost))
+				toolchainCluster.Spec.CABundle = "ZHVtbXk="
+				toolchainCluster.Annotations = map[string]string{cluster.QPSAnnotationKey: "50", cluster.TimeoutAnnotationKey: "5s"}
+				cl := test.NewFakeClient(t, toolchainCluster, secret)
+
+				// when
+				errs := cluster.ValidateToolchainCluster(context.TODO(), cl, toolchainCluster)
+
+				// then
+				assert.Empty(t, errs)
+			})
+		}
+	})
+
+	t.Run("cluster roles without type label", func(t *testing.T) {
+		// given
+		labels := verify.Labels("", "", test.NameHost)
+		labels[cluster.RoleLabel(cluster.Tenant)] = ""
+		toolchainCluster, secret := test.NewToolchainCluster("east", "secret", status, labels)
+		cl := test.NewFakeClient(t, toolchainCluster, secret)
+
+		// when
+		errs := cluster.ValidateToolchainCluster(context.TODO(), cl, toolchainCluster)
+
+		// then
+		assert.Empty(t, errs)
+	})
+
+	t.Run("cluster roles with empty type label", func(t *testing.T) {
+		// given
+		labels := verify.Labels("", "", test.NameHost)
+		labels[cluster.LabelType] = ""
+		labels[cluster.RoleLabel(cluster.Tenant)] = ""
+		toolchainCluster, secret := test.NewToolchainCluster("east", "secret", status, labels)
+		cl := test.NewFakeClient(t, toolchainCluster, secret)
+
+		// when
+		errs := cluster.ValidateToolchainCluster(context.TODO(), cl, toolchainCluster)
+
+		// then
+		assert.Empty(t, errs)
+	})
+
+	t.Run("all problems are reported", func(t *testing.T) {
+		// given
+		labels := verify.Labels(cluster.Host, "Not_A_Namespace", "owner_cluster")
+		labels[cluster.RoleLabel(cluster.Tenant)] = ""
+		toolchainCluster, _ := test.NewToolchainClusterWithEndpoint("east", "secret", "ftp://cluster.com", status, labels)
+		toolchainCluster.Spec.CABundle = "not-base64"
+		toolchainCluster.Spec.DisabledTLSValidations = []toolchainv1alpha1.TLSValidation{toolchainv1alpha1.TLSSubjectName, toolchainv1alpha1.TLSAll, "Unknown"}
+		toolchainCluster.Annotations = map[string]string{cluster.QPSAnnotationKey: "-1", cluster.BurstAnnotationKey: "many"}
+
+		// when
+		errs := cluster.ValidateToolchainCluster(context.TODO(), nil, toolchainCluster)
+
+		// then
+		assert.ElementsMatch(t, []string{
+			"metadata.labels[cluster-role.toolchain.dev.openshift.com/tenant]",
+			"metadata.labels[namespace]",
+			"metadata.labels[ownerClusterName]",
+			"metadata.annotations[toolchain.dev.openshift.com/api-qps]",
+			"metadata.annotations[toolchain.dev.openshift.com/api-burst]",
+			"spec.apiEndpoint",
+			"spec.caBundle",
+			"spec.disabledTLSValidations[1]",
+			"spec.disabledTLSValidations[2]",
+		}, fields(errs))
+		assert.Equal(t, field.ErrorTypeForbidden, errs[0].Type)
+		assert.Contains(t, errs.ToAggregate().Error(), `spec.apiEndpoint: Invalid value: "ftp://cluster.com": must use the http or https scheme, but was "ftp"`)
+	})
+
+	t.Run("required fields", func(t *testing.T) {
+		// given
+		toolchainCluster, _ := test.NewToolchainClusterWithEndpoint("east", "", "", status, map[string]string{"type": "unknown"})
+
+		// when
+		errs := cluster.ValidateToolchainCluster(context.TODO(), test.NewFakeClient(t), toolchainCluster)
+
+		// then
+		require.Len(t, errs, 3)
+		assert.Equal(t, "metadata.labels[type]: Unsupported value: \"unknown\": supported values: \"host\", \"member\"", errs[0].Error())
+		assert.Equal(t, "spec.apiEndpoint: Required value", errs[1].Error())
+		assert.Equal(t, "spec.secretRef.name: Required value", errs[2].Error())
+	})
+
+	t.Run("secret", func(t *testing.T) {
+		t.Run("not found", func(t *testing.T) {
+			// given
+			toolchainCluster, _ := test.NewToolchainCluster("east", "secret", status, verify.Labels(cluster.Member, "", test.NameHost))
+			cl := test.NewFakeClient(t, toolchainCluster)
+
+			// when
+			errs := cluster.ValidateToolchainCluster(context.TODO(), cl, toolchainCluster)
+
+			// then
+			require.Len(t, errs, 1)
+			assert.Equal(t, `spec.secretRef.name: Not found: "secret"`, errs[0].Error())
+		})
+
+		t.Run("without credentials", func(t *testing.T) {
+			// given
+			toolchainCluster, secret := test.NewToolchainCluster("east", "secret", status, verify.Labels(cluster.Member, "", test.NameHost))
+			secret.Data = map[string][]byte{"token": []byte("")}
+			cl := test.NewFakeClient(t, toolchainCluster, secret)
+
+			// when
+			errs := cluster.ValidateToolchainCluster(context.TODO(), cl, toolchainCluster)
+
+			// then
+			require.Len(t, errs, 1)
+			assert.Equal(t, field.ErrorTypeInvalid, errs[0].Type)
+			assert.Equal(t, `the secret for cluster east is missing a non-empty value for "token"`, errs[0].Detail)
+		})
+
+		t.Run("failed to get", func(t *testing.T) {
+			// given
+			toolchainCluster, secret := test.NewToolchainCluster("east", "secret", status, verify.Labels(cluster.Member, "", test.NameHost))
+			cl := test.NewFakeClient(t, toolchainCluster, secret)
+			cl.MockGet = func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				return fmt.Errorf("some error")
+			}
+
+			// when
+			errs := cluster.ValidateToolchainCluster(context.TODO(), cl, toolchainCluster)
+
+			// then
+			require.Len(t, errs, 1)
+			assert.Equal(t, "spec.secretRef.name: Internal error: some error", errs[0].Error())
+		})
+	})
+}
+
+func fields(errs field.ErrorList) []string {
+	fieldNames := make([]string, len(errs))
+	for i, err := range errs {
+		fieldNames[i] = err.Field
+	}
+	return fieldNames
+}
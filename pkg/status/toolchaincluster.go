@@ -19,6 +19,7 @@ const (
 
 // ToolchainClusterAttributes required attributes for obtaining ToolchainCluster status
 type ToolchainClusterAttributes struct {
+	// GetClusterFunc retrieves the cluster from a cache, eg. cluster.GetHostCluster or the GetHostCluster method of a given cluster.ClusterCache instance
 	GetClusterFunc func() (*cluster.CachedToolchainCluster, bool)
 	Period         time.Duration
 	Timeout        time.Duration
@@ -105,10 +105,32 @@ func (c *FakeClient) Update(ctx context.Context, obj client.Object, opts ...clie
 func Update(ctx context.Context, cl *FakeClient, obj client.Object, opts ...client.UpdateOption) error {
 	// Update Generation if needed since the kube fake client doesn't update generations.
 	// Increment the generation if spec (for objects with Spec) or data/stringData (for objects like CM and Secrets) is changed.
-	updatingMap, err := toMap(obj)
+	current, err := cleanObject(obj)
 	if err != nil {
 		return err
 	}
+	if err := cl.Client.Get(ctx, types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}, current); err != nil {
+		return err
+	}
+	changed, err := generationChanged(obj, current)
+	if err != nil {
+		return err
+	}
+	if changed {
+		obj.SetGeneration(current.GetGeneration() + 1)
+	} else {
+		obj.SetGeneration(current.GetGeneration())
+	}
+	return cl.Client.Update(ctx, obj, opts...)
+}
+
+// generationChanged returns true if the generation of the current object would be incremented by the given update,
+// ie. if anything else than the metadata and status is changed
+func generationChanged(updating, current client.Object) (bool, error) {
+	updatingMap, err := toMap(updating)
+	if err != nil {
+		return false, err
+	}
 	updatingMap["metadata"] = nil
 	updatingMap["status"] = nil
 	updatingMap["kind"] = nil
@@ -117,16 +139,9 @@ func Update(ctx context.Context, cl *FakeClient, obj client.Object, opts ...clie
 		updatingMap["spec"] = map[string]interface{}{}
 	}
 
-	current, err := cleanObject(obj)
-	if err != nil {
-		return err
-	}
-	if err := cl.Client.Get(ctx, types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}, current); err != nil {
-		return err
-	}
 	currentMap, err := toMap(current)
 	if err != nil {
-		return err
+		return false, err
 	}
 	currentMap["metadata"] = nil
 	currentMap["status"] = nil
@@ -140,13 +155,7 @@ func Update(ctx context.Context, cl *FakeClient, obj client.Object, opts ...clie
 			updatingMap[key] = nil
 		}
 	}
-
-	if !reflect.DeepEqual(updatingMap, currentMap) {
-		obj.SetGeneration(current.GetGeneration() + 1)
-	} else {
-		obj.SetGeneration(current.GetGeneration())
-	}
-	return cl.Client.Update(ctx, obj, opts...)
+	return !reflect.DeepEqual(updatingMap, currentMap), nil
 }
 
 func cleanObject(obj client.Object) (client.Object, error) {
@@ -200,5 +209,29 @@ func (c *FakeClient) Patch(ctx context.Context, obj client.Object, patch client.
 	if c.MockPatch != nil {
 		return c.MockPatch(ctx, obj, patch, opts...)
 	}
-	return c.Client.Patch(ctx, obj, patch, opts...)
+	return Patch(ctx, c, obj, patch, opts...)
+}
+
+func Patch(ctx context.Context, cl *FakeClient, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	// Update Generation if needed since the kube fake client doesn't update generations.
+	// Increment the generation the same way as Update does, ie. if the patch changed spec (for objects with Spec)
+	// or data/stringData (for objects like CM and Secrets).
+	patchOptions := &client.PatchOptions{}
+	patchOptions.ApplyOptions(opts)
+	current, err := cleanObject(obj)
+	if err != nil {
+		return err
+	}
+	if len(patchOptions.DryRun) > 0 || cl.Client.Get(ctx, types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}, current) != nil {
+		return cl.Client.Patch(ctx, obj, patch, opts...)
+	}
+	if err := cl.Client.Patch(ctx, obj, patch, opts...); err != nil {
+		return err
+	}
+	changed, err := generationChanged(obj, current)
+	if err != nil || !changed {
+		return err
+	}
+	obj.SetGeneration(current.GetGeneration() + 1)
+	return cl.Client.Update(ctx, obj)
 }
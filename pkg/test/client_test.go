@@ -14,6 +14,7 @@ import (
 	errs "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -132,6 +133,67 @@ func TestNewClient(t *testing.T) {
 			assert.Equal(t, annotations, retrieved.GetObjectMeta().GetAnnotations())
 		})
 
+		t.Run("patch object with spec", func(t *testing.T) {
+			created, retrieved := createAndGetDeployment(t, fclient)
+			mergePatch, err := json.Marshal(map[string]interface{}{
+				"spec": map[string]interface{}{
+					"replicas": 10,
+				},
+			})
+			require.NoError(t, err)
+			assert.NoError(t, fclient.Patch(context.TODO(), created, client.RawPatch(types.MergePatchType, mergePatch)))
+			assert.NoError(t, fclient.Get(context.TODO(), types.NamespacedName{Namespace: "somenamespace", Name: created.Name}, retrieved))
+			require.NotNil(t, retrieved.Spec.Replicas)
+			assert.EqualValues(t, 10, *retrieved.Spec.Replicas)
+			assert.EqualValues(t, 2, retrieved.Generation) // Generation updated
+		})
+
+		t.Run("patch object with same spec", func(t *testing.T) {
+			created, retrieved := createAndGetDeployment(t, fclient)
+			mergePatch, err := json.Marshal(map[string]interface{}{
+				"spec": map[string]interface{}{
+					"replicas": 1,
+				},
+			})
+			require.NoError(t, err)
+			assert.NoError(t, fclient.Patch(context.TODO(), created, client.RawPatch(types.MergePatchType, mergePatch)))
+			assert.NoError(t, fclient.Get(context.TODO(), types.NamespacedName{Namespace: "somenamespace", Name: created.Name}, retrieved))
+			assert.EqualValues(t, 1, retrieved.Generation) // Generation not changed
+		})
+
+		t.Run("patch changes generation the same way as update", func(t *testing.T) {
+			for name, tc := range map[string]struct {
+				modify             func(*appsv1.Deployment)
+				expectedGeneration int64
+			}{
+				"spec":        {modify: func(d *appsv1.Deployment) { d.Spec.Replicas = pointer.Int32(10) }, expectedGeneration: 2},
+				"same spec":   {modify: func(d *appsv1.Deployment) { d.Spec.Replicas = pointer.Int32(1) }, expectedGeneration: 1},
+				"labels only": {modify: func(d *appsv1.Deployment) { d.Labels = map[string]string{"foo": "baz"} }, expectedGeneration: 1},
+				"status only": {modify: func(d *appsv1.Deployment) { d.Status.Replicas = 3 }, expectedGeneration: 1},
+			} {
+				t.Run(name, func(t *testing.T) {
+					// given
+					updated, _ := createAndGetDeployment(t, fclient)
+					patched, _ := createAndGetDeployment(t, fclient)
+					original := patched.DeepCopy()
+
+					// when
+					tc.modify(updated)
+					require.NoError(t, fclient.Update(context.TODO(), updated))
+					tc.modify(patched)
+					require.NoError(t, fclient.Patch(context.TODO(), patched, client.MergeFrom(original)))
+
+					// then
+					retrievedUpdated := &appsv1.Deployment{}
+					require.NoError(t, fclient.Get(context.TODO(), client.ObjectKeyFromObject(updated), retrievedUpdated))
+					retrievedPatched := &appsv1.Deployment{}
+					require.NoError(t, fclient.Get(context.TODO(), client.ObjectKeyFromObject(patched), retrievedPatched))
+					assert.Equal(t, tc.expectedGeneration, retrievedUpdated.Generation)
+					assert.Equal(t, tc.expectedGeneration, retrievedPatched.Generation)
+				})
+			}
+		})
+
 		t.Run("status patch", func(t *testing.T) {
 			_, retrieved := createAndGetDeployment(t, fclient)
 			depPatch := client.MergeFrom(retrieved.DeepCopy())
@@ -62,7 +62,7 @@ func AddToolchainClusterAsMember(t *testing.T, functionToVerify FunctionToVerify
 				} else {
 					require.False(t, found)
 				}
-				assert.Equal(t, status, *cachedToolchainCluster.ClusterStatus)
+				assertContainsConditions(t, status, cachedToolchainCluster.ClusterStatus)
 				assert.Equal(t, test.NameHost, cachedToolchainCluster.OwnerClusterName)
 				assert.Equal(t, "http://cluster.com", cachedToolchainCluster.APIEndpoint)
 			}
@@ -107,7 +107,7 @@ func AddToolchainClusterAsHost(t *testing.T, functionToVerify FunctionToVerify)
 				expectedToolChainClusterRoleLabel := cluster.RoleLabel(cluster.Tenant)
 				_, found := toolchainCluster.Labels[expectedToolChainClusterRoleLabel]
 				require.False(t, found)
-				assert.Equal(t, status, *cachedToolchainCluster.ClusterStatus)
+				assertContainsConditions(t, status, cachedToolchainCluster.ClusterStatus)
 				assert.Equal(t, test.NameMember, cachedToolchainCluster.OwnerClusterName)
 				assert.Equal(t, "http://cluster.com", cachedToolchainCluster.APIEndpoint)
 			}
@@ -179,7 +179,7 @@ func UpdateToolchainCluster(t *testing.T, functionToVerify FunctionToVerify) {
 	require.NoError(t, err)
 	cachedToolchainCluster, ok := cluster.GetCachedToolchainCluster("east")
 	require.True(t, ok)
-	assert.Equal(t, statusFalse, *cachedToolchainCluster.ClusterStatus)
+	assertContainsConditions(t, statusFalse, cachedToolchainCluster.ClusterStatus)
 	AssertClusterConfigThat(t, cachedToolchainCluster.Config).
 		IsOfType(cluster.Host).
 		HasName("east").
@@ -229,11 +229,12 @@ func Labels(clType cluster.Type, ns, ownerClusterName string) map[string]string
 
 func newToolchainClusterService(t *testing.T, cl client.Client, withCA bool) cluster.ToolchainClusterService {
 	return cluster.NewToolchainClusterServiceWithClient(cl, logf.Log, "test-namespace", 3*time.Second, func(config *rest.Config, options client.Options) (client.Client, error) {
+		// the TLS verification is never disabled unless the ToolchainCluster explicitly opts in
+		assert.False(t, config.Insecure)
 		if withCA {
-			assert.False(t, config.Insecure)
 			assert.Equal(t, []byte("dummy"), config.CAData)
 		} else {
-			assert.True(t, config.Insecure)
+			assert.Empty(t, config.CAData)
 		}
 		// make sure that insecure is false to make Gock mocking working properly
 		config.Insecure = false
@@ -290,3 +291,10 @@ func (a *ClusterConfigAssertion) RestConfigHasHost(host string) *ClusterConfigAs
 	assert.Equal(a.t, host, a.clusterConfig.RestConfig.Host)
 	return a
 }
+
+// assertContainsConditions verifies that the actual status contains all the expected conditions. The actual status
+// may contain also some other conditions set by the function under test (eg. ConfigurationValid set by the controller).
+func assertContainsConditions(t *testing.T, expected toolchainv1alpha1.ToolchainClusterStatus, actual *toolchainv1alpha1.ToolchainClusterStatus) {
+	require.NotNil(t, actual)
+	assert.Subset(t, actual.Conditions, expected.Conditions)
+}